@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// maxBodyBytesHeader reports the body size limit on 413 responses, so senders know what they can send.
+const maxBodyBytesHeader = "X-Max-Body-Bytes"
+
+// maxBodyBytes returns the largest webhook body accepted, from `PAYLOAD_MAX_BYTES`; 0 or less is unlimited.
+func maxBodyBytes() int {
+	return payloadDecodeLimits().MaxBytes
+}
+
+// limitBodySize rejects webhook bodies over `maxBodyBytes()` with a 413 before they're read into memory,
+// reporting the limit in the `X-Max-Body-Bytes` header and the response message. Bodies are limited as
+// sent, so a gzipped body is limited before it's decompressed.
+func limitBodySize(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		limit := maxBodyBytes()
+		if limit <= 0 {
+			return action(rc)
+		}
+		if rc.Request.ContentLength > int64(limit) {
+			return bodyTooLarge(rc, limit)
+		}
+
+		body, err := ioutil.ReadAll(http.MaxBytesReader(rc.Response, rc.Request.Body, int64(limit)))
+		rc.Request.Body.Close()
+		if err != nil {
+			var tooLarge *http.MaxBytesError
+			if errors.As(err, &tooLarge) {
+				return bodyTooLarge(rc, limit)
+			}
+			rc.Logger().Errorf("limitBodySize::ReadAll() %v", err)
+			return rc.API().BadRequest(err.Error())
+		}
+		rc.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		return action(rc)
+	}
+}
+
+func bodyTooLarge(rc *web.RequestContext, limit int) web.ControllerResult {
+	rc.Logger().Errorf("limitBodySize::request body exceeds the limit of %d bytes.", limit)
+	rc.Response.Header().Set(maxBodyBytesHeader, strconv.Itoa(limit))
+	return rc.API().RequestEntityTooLarge(fmt.Sprintf("Request body exceeds the limit of %d bytes", limit))
+}
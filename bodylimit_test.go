@@ -0,0 +1,78 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func TestLimitBodySize(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("PAYLOAD_MAX_BYTES", os.Getenv("PAYLOAD_MAX_BYTES"))
+	os.Setenv("PAYLOAD_MAX_BYTES", "64")
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Empty(res.Header.Get(maxBodyBytesHeader))
+
+	oversize := []byte(`{"id":450789469,"total_price":"12.50","note":"` + strings.Repeat("x", 64) + `"}`)
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(oversize).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Equal("64", res.Header.Get(maxBodyBytesHeader))
+
+	var rejection web.APIResponse
+	assert.Nil(json.NewDecoder(res.Body).Decode(&rejection))
+	assert.Equal(http.StatusRequestEntityTooLarge, rejection.Meta.HTTPCode)
+	assert.Equal("Request body exceeds the limit of 64 bytes", rejection.Meta.Message)
+	assert.Len(captured.Requests(), 1, "rejected webhooks aren't notified")
+}
+
+func TestLimitBodySizeWithoutContentLength(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("PAYLOAD_MAX_BYTES", os.Getenv("PAYLOAD_MAX_BYTES"))
+	os.Setenv("PAYLOAD_MAX_BYTES", "16")
+
+	var handled []byte
+	app := web.New()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	app.POST("/order", func(rc *web.RequestContext) web.ControllerResult {
+		handled = rc.PostBody()
+		return rc.JSON(ok)
+	}, limitBodySize)
+
+	server := httptest.NewServer(app)
+	defer server.Close()
+
+	// a reader without a known length is sent chunked, so only the limited read can catch it.
+	res, err := http.Post(server.URL+"/order", contentTypeJSON, ioutil.NopCloser(strings.NewReader(strings.Repeat("x", 17))))
+	assert.Nil(err)
+	res.Body.Close()
+	assert.Equal(http.StatusRequestEntityTooLarge, res.StatusCode)
+	assert.Equal("16", res.Header.Get(maxBodyBytesHeader))
+	assert.Nil(handled)
+
+	res, err = http.Post(server.URL+"/order", contentTypeJSON, ioutil.NopCloser(bytes.NewReader([]byte(`{"id":1}`))))
+	assert.Nil(err)
+	res.Body.Close()
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(`{"id":1}`, string(handled), "bodies within the limit are passed on")
+}
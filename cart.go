@@ -0,0 +1,88 @@
+package main
+
+import (
+	"sync"
+	"time"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// defaultCartNotifyWindow is how long after notifying about a cart further updates to it are suppressed.
+const defaultCartNotifyWindow = time.Hour
+
+// cartThrottle debounces cart notifications, since shopify sends `carts/update` on every change.
+var cartThrottle = newCartThrottleStore(envDuration("CART_NOTIFY_WINDOW", defaultCartNotifyWindow), time.Now)
+
+func newCartThrottleStore(window time.Duration, now func() time.Time) *cartThrottleStore {
+	return &cartThrottleStore{window: window, now: now, lastNotified: map[string]time.Time{}}
+}
+
+// cartThrottleStore tracks when each cart, by token, was last notified.
+type cartThrottleStore struct {
+	sync.Mutex
+	window       time.Duration
+	now          func() time.Time
+	lastNotified map[string]time.Time
+}
+
+// Claim records that a cart is being notified and returns true, unless it was already claimed within
+// the window. Checking and marking happen under one lock, so concurrent updates to a cart notify once.
+// Carts past the window are forgotten.
+func (cts *cartThrottleStore) Claim(token string) bool {
+	cts.Lock()
+	defer cts.Unlock()
+
+	now := cts.now()
+	for key, notified := range cts.lastNotified {
+		if now.Sub(notified) >= cts.window {
+			delete(cts.lastNotified, key)
+		}
+	}
+	if _, hasNotified := cts.lastNotified[token]; hasNotified {
+		return false
+	}
+	cts.lastNotified[token] = now
+	return true
+}
+
+// Unmark releases a claimed cart, so its next update notifies again.
+func (cts *cartThrottleStore) Unmark(token string) {
+	cts.Lock()
+	defer cts.Unlock()
+	delete(cts.lastNotified, token)
+}
+
+func cartAction(rc *web.RequestContext) web.ControllerResult {
+	parsed, err := decodePayload(rc.PostBody(), payloadDecodeLimits())
+	if err != nil {
+		return rc.API().BadRequest(err.Error())
+	}
+
+	token := readMapString(parsed, "token")
+	lineItems, _ := readMap(parsed, "line_items").([]interface{})
+	if len(token) == 0 || len(lineItems) == 0 {
+		return rc.JSON(ok)
+	}
+	if !cartThrottle.Claim(token) {
+		return rc.JSON(ok)
+	}
+	err = notify(&notification{
+		Topic: "carts/update",
+		Text: messagef(
+			`:shopping_trolley: Open Cart!
+                %d item(s) in cart %v`,
+			len(lineItems),
+			token,
+		),
+		Username: "Shopify (Cart)",
+		IconURL:  shopifyIconURL,
+		Payload:  allowedPayload(parsed),
+	})
+	if err != nil {
+		// a cart that failed to notify is released, so the next update retries it. with the delivery
+		// queue, `notify` succeeds once the cart is queued, so a later failed delivery stays suppressed.
+		cartThrottle.Unmark(token)
+		return rc.API().InternalError(err)
+	}
+	return rc.JSON(ok)
+}
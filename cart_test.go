@@ -0,0 +1,117 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestCartThrottle(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Now()}
+	throttle := newCartThrottleStore(time.Hour, clock.Now)
+
+	assert.True(throttle.Claim("cart-1"))
+	assert.False(throttle.Claim("cart-1"))
+	assert.True(throttle.Claim("cart-2"))
+
+	clock.Sleep(59 * time.Minute)
+	assert.False(throttle.Claim("cart-1"))
+
+	clock.Sleep(time.Minute)
+	assert.True(throttle.Claim("cart-1"))
+	assert.Len(throttle.lastNotified, 1, "carts past the window are forgotten")
+
+	throttle.Unmark("cart-1")
+	assert.True(throttle.Claim("cart-1"), "unmarked carts can be claimed again")
+}
+
+func TestCartThrottleConcurrentClaims(t *testing.T) {
+	assert := assert.New(t)
+
+	throttle := newCartThrottleStore(time.Hour, time.Now)
+	claims := make(chan bool, 50)
+	var wg sync.WaitGroup
+	for index := 0; index < cap(claims); index++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			claims <- throttle.Claim("cart-1")
+		}()
+	}
+	wg.Wait()
+	close(claims)
+
+	var claimed int
+	for claim := range claims {
+		if claim {
+			claimed++
+		}
+	}
+	assert.Equal(1, claimed, "only one concurrent update claims the cart")
+}
+
+func TestCartRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func(throttle *cartThrottleStore) { cartThrottle = throttle }(cartThrottle)
+	cartThrottle = newCartThrottleStore(time.Hour, time.Now)
+
+	app := newApp()
+	cart := []byte(`{"token":"eeafa272cebfd4b22385bc4b645e762c","line_items":[{"id":1,"quantity":2},{"id":2,"quantity":1}]}`)
+	for x := 0; x < 2; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/cart").WithPostBody(cart).Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+	assert.Len(captured.Requests(), 1, "the second update within the window is suppressed")
+
+	var body map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &body))
+	assert.Contains("Open Cart!", body["text"].(string))
+	assert.Contains("2 item(s) in cart eeafa272cebfd4b22385bc4b645e762c", body["text"].(string))
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/cart").
+		WithPostBody([]byte(`{"token":"4f1b7b5c","line_items":[]}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Len(captured.Requests(), 1, "empty carts aren't notified")
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/webhook").WithHeader("X-Shopify-Topic", "carts/update").
+		WithPostBody([]byte(`{"token":"4f1b7b5c","line_items":[{"id":3}]}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Len(captured.Requests(), 2)
+}
+
+func TestCartRouteNotifyFailure(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 1}
+	captured := recordOutbound(http.StatusInternalServerError, "internal_error")
+	defer captured.Restore()
+	defer func(throttle *cartThrottleStore) { cartThrottle = throttle }(cartThrottle)
+	cartThrottle = newCartThrottleStore(time.Hour, time.Now)
+
+	app := newApp()
+	cart := []byte(`{"token":"eeafa272cebfd4b22385bc4b645e762c","line_items":[{"id":1,"quantity":2}]}`)
+	res, err := app.Mock().WithVerb("POST").WithPathf("/cart").WithPostBody(cart).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusInternalServerError, res.StatusCode)
+	assert.Empty(cartThrottle.lastNotified, "a cart that failed to notify isn't suppressed")
+
+	captured.StatusCode, captured.Body = http.StatusOK, "ok"
+	res, err = app.Mock().WithVerb("POST").WithPathf("/cart").WithPostBody(cart).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.False(cartThrottle.Claim("eeafa272cebfd4b22385bc4b645e762c"))
+	assert.Len(captured.Requests(), 2, "the next update notifies again")
+}
@@ -0,0 +1,97 @@
+package main
+
+import (
+	"os"
+	"strconv"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// configSetting is a recognized configuration key.
+type configSetting struct {
+	Name    string
+	Default string
+	Secret  bool
+}
+
+// configSettings are the configuration keys the bus recognizes, all read from the environment.
+var configSettings = []configSetting{
+	{Name: "PORT", Default: "8080"},
+	{Name: "SHARED_SECRET", Secret: true},
+	{Name: "REQUIRE_SIGNATURE", Default: "false"},
+	{Name: "SIGNATURE_ENCODING", Default: signatureEncodingBase64},
+	{Name: "HMAC_HEADER_NAME", Default: defaultHMACHeaderName},
+	{Name: "SIGNATURE_PREFIX"},
+	{Name: "NOTIFIER", Default: "slack"},
+	{Name: "NOTIFIER_FALLBACKS"},
+	{Name: "FALLBACK_TOPICS"},
+	{Name: "TOPIC_SEVERITIES"},
+	{Name: "SEVERITY_NOTIFIERS"},
+	{Name: "SLACK_WEBHOOK", Secret: true},
+	{Name: "SLACK_WEBHOOK_ORDER", Secret: true},
+	{Name: "SLACK_WEBHOOK_SHOPPER", Secret: true},
+	{Name: "SLACK_WEBHOOK_PRODUCT", Secret: true},
+	{Name: "SLACK_FORMAT", Default: "text"},
+	{Name: "SLACK_MAX_CONCURRENCY", Default: "0"},
+	{Name: "SLACK_RETRY_RATE"},
+	{Name: "SLACK_RETRY_BURST", Default: strconv.Itoa(defaultSlackRetryBurst)},
+	{Name: "SLACK_TEMPLATE"},
+	{Name: "DISCORD_WEBHOOK", Secret: true},
+	{Name: "DISCORD_TEMPLATE"},
+	{Name: "NOTIFIER_URL", Secret: true},
+	{Name: "NOTIFIER_METHOD", Default: "POST"},
+	{Name: "NOTIFIER_CONTENT_TYPE", Default: contentTypeJSON},
+	{Name: "NOTIFIER_BODY_TEMPLATE"},
+	{Name: "PAGERDUTY_ROUTING_KEY", Secret: true},
+	{Name: "PAGERDUTY_SEVERITIES"},
+	{Name: "DEBUG_TOKEN", Secret: true},
+	{Name: "MATCH_TRAILING_SLASH", Default: "true"},
+	{Name: "MAX_INFLIGHT", Default: "0"},
+	{Name: "RATE_LIMIT", Default: "0"},
+	{Name: "RATE_LIMIT_WINDOW", Default: defaultRateLimitWindow.String()},
+	{Name: "DEDUP_TTL"},
+	{Name: "RETRY_ATTEMPTS", Default: strconv.Itoa(defaultRetryAttempts)},
+	{Name: "RETRY_BASE_DELAY", Default: defaultRetryBaseDelay.String()},
+	{Name: "RETRY_MAX_DELAY", Default: defaultRetryMaxDelay.String()},
+	{Name: "RETRY_MAX_ELAPSED", Default: defaultRetryMaxElapsed.String()},
+	{Name: "PAYLOAD_ALLOWLIST"},
+	{Name: "PAYLOAD_MAX_BYTES", Default: strconv.Itoa(defaultPayloadMaxBytes)},
+	{Name: "PAYLOAD_MAX_DEPTH", Default: strconv.Itoa(defaultPayloadMaxDepth)},
+	{Name: "PAYLOAD_MAX_TOKENS", Default: strconv.Itoa(defaultPayloadMaxTokens)},
+	{Name: "FINANCIAL_STATUS_EMOJI"},
+	{Name: "SHOP_DOMAIN", Default: fallbackShopDomain},
+	{Name: "ALLOWED_SHOP_DOMAINS"},
+	{Name: "SHOPPER_DIGEST_WINDOW"},
+	{Name: "SHOPPER_DIGEST_THRESHOLD", Default: strconv.Itoa(defaultShopperDigestThreshold)},
+	{Name: "CART_NOTIFY_WINDOW", Default: defaultCartNotifyWindow.String()},
+	{Name: "SHUTDOWN_TIMEOUT", Default: defaultShutdownTimeout.String()},
+	{Name: "TEE_URL", Secret: true},
+	{Name: "TEE_TIMEOUT", Default: defaultTeeTimeout.String()},
+	{Name: "TEE_RETRY_ATTEMPTS", Default: strconv.Itoa(defaultTeeRetryAttempts)},
+	{Name: "TEE_RETRY_BASE_DELAY", Default: defaultTeeRetryBaseDelay.String()},
+	{Name: "DELIVERY_MODE", Default: deliveryModeAsync},
+	{Name: "QUEUE_CAPACITY", Default: strconv.Itoa(defaultQueueCapacity)},
+	{Name: "QUEUE_FULL_POLICY", Default: queueFullPolicyBlock},
+}
+
+// LogEffectiveConfig logs every recognized configuration key, whether it came from the environment
+// or is defaulted, and its value. Secrets are only logged as set or unset.
+func LogEffectiveConfig(logger web.Logger) {
+	for _, setting := range configSettings {
+		value, source := os.Getenv(setting.Name), "env"
+		if len(value) == 0 {
+			value, source = setting.Default, "default"
+		}
+
+		if setting.Secret {
+			if len(value) == 0 {
+				value = "<unset>"
+			} else {
+				value = "<set>"
+			}
+		} else if len(value) == 0 {
+			value = "<empty>"
+		}
+		logger.Logf("config: %s=%s (%s)", setting.Name, value, source)
+	}
+}
@@ -0,0 +1,38 @@
+package main
+
+import (
+	"bytes"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func TestLogEffectiveConfig(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Setenv("SHARED_SECRET", os.Getenv("SHARED_SECRET"))
+	defer os.Setenv("DEBUG_TOKEN", os.Getenv("DEBUG_TOKEN"))
+	defer os.Setenv("SLACK_WEBHOOK", os.Getenv("SLACK_WEBHOOK"))
+	defer os.Setenv("NOTIFIER", os.Getenv("NOTIFIER"))
+	defer os.Setenv("MATCH_TRAILING_SLASH", os.Getenv("MATCH_TRAILING_SLASH"))
+
+	os.Setenv("SHARED_SECRET", "c2hoaGgtc2VjcmV0")
+	os.Setenv("DEBUG_TOKEN", "super-secret-token")
+	os.Setenv("SLACK_WEBHOOK", "")
+	os.Setenv("NOTIFIER", "webhook")
+	os.Setenv("MATCH_TRAILING_SLASH", "")
+
+	buffer := bytes.NewBuffer(nil)
+	LogEffectiveConfig(web.NewLogger(buffer, buffer))
+	output := buffer.String()
+
+	assert.False(strings.Contains(output, "c2hoaGgtc2VjcmV0"))
+	assert.False(strings.Contains(output, "super-secret-token"))
+	assert.Contains("SHARED_SECRET=<set> (env)", output)
+	assert.Contains("DEBUG_TOKEN=<set> (env)", output)
+	assert.Contains("SLACK_WEBHOOK=<unset> (default)", output)
+	assert.Contains("NOTIFIER=webhook (env)", output)
+	assert.Contains("MATCH_TRAILING_SLASH=true (default)", output)
+}
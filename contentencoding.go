@@ -0,0 +1,57 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"strconv"
+	"strings"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// decodeContentEncoding decompresses gzipped webhook bodies in place, so the signature is checked and
+// the payload parsed over the json shopify signed rather than its compressed bytes. Bodies with any
+// other `Content-Encoding` are rejected with a 415, and bodies that don't decompress with a 400.
+func decodeContentEncoding(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		encoding := strings.ToLower(strings.TrimSpace(rc.Request.Header.Get("Content-Encoding")))
+		switch encoding {
+		case "", "identity":
+			return action(rc)
+		case "gzip", "x-gzip":
+		default:
+			rc.Logger().Errorf("decodeContentEncoding::unsupported content encoding `%s`.", encoding)
+			return rc.API().UnsupportedMediaType("Unsupported content encoding")
+		}
+
+		body, err := gunzip(rc.Request.Body, payloadDecodeLimits().MaxBytes)
+		rc.Request.Body.Close()
+		if err != nil {
+			rc.Logger().Errorf("decodeContentEncoding::gunzip() %v", err)
+			return rc.API().BadRequest(err.Error())
+		}
+		rc.Request.Body = ioutil.NopCloser(bytes.NewReader(body))
+		rc.Request.ContentLength = int64(len(body))
+		rc.Request.Header.Del("Content-Encoding")
+		rc.Request.Header.Set("Content-Length", strconv.Itoa(len(body)))
+		return action(rc)
+	}
+}
+
+// gunzip decompresses a gzipped body, reading at most one byte past `maxBytes` (if positive) so a
+// small body can't inflate without bound; `decodePayload` rejects it if it's over the limit.
+func gunzip(body io.Reader, maxBytes int) ([]byte, error) {
+	reader, err := gzip.NewReader(body)
+	if err != nil {
+		return nil, err
+	}
+	defer reader.Close()
+
+	var limited io.Reader = reader
+	if maxBytes > 0 {
+		limited = io.LimitReader(reader, int64(maxBytes)+1)
+	}
+	return ioutil.ReadAll(limited)
+}
@@ -0,0 +1,93 @@
+package main
+
+import (
+	"bytes"
+	"compress/gzip"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func gzipped(body []byte) []byte {
+	buffer := bytes.NewBuffer(nil)
+	writer := gzip.NewWriter(buffer)
+	writer.Write(body)
+	writer.Close()
+	return buffer.Bytes()
+}
+
+func TestDecodeContentEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	for _, encoding := range []string{"", "identity"} {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+			WithHeader("Content-Encoding", encoding).WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode, encoding)
+	}
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(gzipped(body)).
+		WithHeader("Content-Encoding", "GZIP").WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode, "the signature is checked over the decompressed body")
+
+	requests := captured.Requests()
+	assert.Len(requests, 3)
+	var notified map[string]interface{}
+	assert.Nil(json.Unmarshal(requests[2].Body, &notified))
+	assert.Contains("New Sale!", notified["text"].(string))
+}
+
+func TestDecodeContentEncodingRejected(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).WithHeader("Content-Encoding", "br").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusUnsupportedMediaType, res.StatusCode)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).WithHeader("Content-Encoding", "gzip").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode, "bodies that aren't gzipped are rejected")
+	assert.Empty(captured.Requests())
+}
+
+func TestGunzipLimit(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("PAYLOAD_MAX_BYTES", os.Getenv("PAYLOAD_MAX_BYTES"))
+	os.Setenv("PAYLOAD_MAX_BYTES", "16")
+
+	body, err := gunzip(bytes.NewReader(gzipped(bytes.Repeat([]byte("a"), 1<<20))), payloadDecodeLimits().MaxBytes)
+	assert.Nil(err)
+	assert.Len(body, 17, "decompression stops just past the limit")
+	_, err = decodePayload(body, payloadDecodeLimits())
+	assert.NotNil(err)
+}
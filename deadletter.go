@@ -0,0 +1,159 @@
+package main
+
+import (
+	"crypto/subtle"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// deadLetterCapacity is the most dead-lettered notifications kept, oldest are dropped first.
+const deadLetterCapacity = 1024
+
+var deadLetters = newDeadLetterStore(deadLetterCapacity)
+
+// deadLetter is a notification that failed delivery.
+type deadLetter struct {
+	Notification *notification
+	// Notifier is what the notification is redelivered with, or nil for the active notifier.
+	Notifier notifier
+	Error    string
+	FailedAt time.Time
+}
+
+func newDeadLetterStore(capacity int) *deadLetterStore {
+	return &deadLetterStore{capacity: capacity}
+}
+
+// deadLetterStore holds notifications that failed delivery so they can be redelivered later.
+type deadLetterStore struct {
+	sync.Mutex
+	capacity int
+	items    []*deadLetter
+}
+
+// Add dead-letters a notification, to be redelivered with the active notifier.
+func (dls *deadLetterStore) Add(n *notification, err error) {
+	dls.AddFor(nil, n, err)
+}
+
+// AddFor dead-letters a notification, to be redelivered with the given notifier.
+func (dls *deadLetterStore) AddFor(target notifier, n *notification, err error) {
+	dls.Lock()
+	defer dls.Unlock()
+
+	dls.items = append(dls.items, &deadLetter{Notification: n, Notifier: target, Error: err.Error(), FailedAt: time.Now().UTC()})
+	if len(dls.items) > dls.capacity {
+		dls.items = dls.items[len(dls.items)-dls.capacity:]
+	}
+}
+
+// Drain removes and returns every dead-lettered notification.
+func (dls *deadLetterStore) Drain() []*deadLetter {
+	dls.Lock()
+	defer dls.Unlock()
+
+	items := dls.items
+	dls.items = nil
+	return items
+}
+
+// Len returns the number of dead-lettered notifications.
+func (dls *deadLetterStore) Len() int {
+	dls.Lock()
+	defer dls.Unlock()
+	return len(dls.items)
+}
+
+// notify sends a notification with the active notifier, retrying per `deliveryRetryPolicy()` and
+// dead-lettering it if every attempt fails. If the delivery queue is running the notification is
+// queued instead, and a notification the queue drops is dead-lettered.
+func notify(n *notification) error {
+	if queue := _deliveryQueue; queue != nil {
+		if err := queue.Enqueue(n); err != nil {
+			deadLetters.Add(n, err)
+		}
+		return nil
+	}
+	return deliver(n, deliveryRetryPolicy())
+}
+
+// deliver sends a notification with the active notifier under the given retry policy, dead-lettering it on failure.
+func deliver(n *notification, policy *retryPolicy) error {
+	return deliverWith(nil, n, policy)
+}
+
+// deliverWith sends a notification with the given notifier, or the active notifier if it's nil, under
+// the given retry policy. If only some of a multiNotifier's notifiers fail, each of those is dead-lettered
+// on its own, so redelivering doesn't resend to the ones that succeeded.
+func deliverWith(target notifier, n *notification, policy *retryPolicy) error {
+	err := policy.Do(func() error {
+		if target != nil {
+			return target.Notify(n)
+		}
+		return activeNotifier().Notify(n)
+	})
+	if err == nil {
+		return nil
+	}
+
+	cause := err
+	if typed, isPermanent := cause.(*permanentError); isPermanent {
+		cause = typed.Err
+	}
+	if failed, isMulti := cause.(*multiNotifierError); isMulti {
+		for index, notifier := range failed.Notifiers {
+			deadLetters.AddFor(notifier, failed.Notification, failed.Errors[index])
+		}
+		return err
+	}
+	deadLetters.AddFor(target, n, err)
+	return err
+}
+
+// flushResult is the response for the dead-letter flush endpoint.
+type flushResult struct {
+	Succeeded int `json:"succeeded"`
+	Failed    int `json:"failed"`
+}
+
+// flushAction redelivers every dead-lettered notification once, failures are dead-lettered again.
+func flushAction(rc *web.RequestContext) web.ControllerResult {
+	var result flushResult
+	for _, letter := range deadLetters.Drain() {
+		if err := deliverWith(letter.Notifier, letter.Notification, &retryPolicy{Attempts: 1}); err != nil {
+			result.Failed++
+		} else {
+			result.Succeeded++
+		}
+	}
+	return rc.JSON(result)
+}
+
+// debugToken returns the bearer token for the debug endpoints; they are disabled if it is unset.
+func debugToken() string {
+	return os.Getenv("DEBUG_TOKEN")
+}
+
+// requireDebugToken requires an `Authorization: Bearer <DEBUG_TOKEN>` header.
+func requireDebugToken(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		token := debugToken()
+		if len(token) == 0 {
+			return rc.API().NotFound()
+		}
+
+		authorization := rc.Request.Header.Get("Authorization")
+		if !strings.HasPrefix(authorization, "Bearer ") {
+			return rc.API().NotAuthorized()
+		}
+		provided := strings.TrimPrefix(authorization, "Bearer ")
+		if subtle.ConstantTimeCompare([]byte(provided), []byte(token)) != 1 {
+			return rc.API().NotAuthorized()
+		}
+		return action(rc)
+	}
+}
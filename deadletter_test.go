@@ -0,0 +1,134 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func flushTestApp() *web.App {
+	app := web.New()
+	app.POST("/debug/flush", flushAction, requireDebugToken)
+	return app
+}
+
+func TestDeadLetterStore(t *testing.T) {
+	assert := assert.New(t)
+
+	store := newDeadLetterStore(2)
+	store.Add(&notification{Text: "one"}, fmt.Errorf("failed"))
+	store.Add(&notification{Text: "two"}, fmt.Errorf("failed"))
+	store.Add(&notification{Text: "three"}, fmt.Errorf("failed"))
+	assert.Equal(2, store.Len())
+
+	drained := store.Drain()
+	assert.Len(drained, 2)
+	assert.Equal("two", drained[0].Notification.Text)
+	assert.Equal("failed", drained[0].Error)
+	assert.Zero(store.Len())
+}
+
+func TestFlushRedelivers(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DEBUG_TOKEN", os.Getenv("DEBUG_TOKEN"))
+	os.Setenv("DEBUG_TOKEN", "test-token")
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	deadLetters.Drain()
+	deadLetters.Add(&notification{Text: "one"}, fmt.Errorf("slack is down"))
+	deadLetters.Add(&notification{Text: "two"}, fmt.Errorf("slack is down"))
+
+	var result flushResult
+	err := flushTestApp().Mock().WithVerb("POST").WithPathf("/debug/flush").
+		WithHeader("Authorization", "Bearer test-token").JSON(&result)
+	assert.Nil(err)
+	assert.Equal(2, result.Succeeded)
+	assert.Zero(result.Failed)
+	assert.Len(captured.Requests(), 2)
+	assert.Zero(deadLetters.Len())
+}
+
+func TestFlushRedeliversOnlyFailedNotifiers(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DEBUG_TOKEN", os.Getenv("DEBUG_TOKEN"))
+	os.Setenv("DEBUG_TOKEN", "test-token")
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 1}
+	defer func(n notifier) { _notifier = n }(_notifier)
+	defer func() { deadLetters = newDeadLetterStore(deadLetterCapacity) }()
+	deadLetters = newDeadLetterStore(deadLetterCapacity)
+
+	slack := &countingNotifier{}
+	pagerDuty := &countingNotifier{Err: fmt.Errorf("pagerduty is down")}
+	discord := &countingNotifier{Err: fmt.Errorf("discord is down")}
+	_notifier = multiNotifier{slack, pagerDuty, discord}
+
+	err := deliver(&notification{Topic: "orders/create", Text: "New Sale!"}, deliveryRetryPolicy())
+	assert.NotNil(err)
+	assert.Equal("2 of 3 notifiers failed: pagerduty is down; discord is down", err.Error())
+	assert.Equal(2, deadLetters.Len(), "each failed notifier is dead-lettered on its own")
+
+	pagerDuty.Err = nil
+	var result flushResult
+	err = flushTestApp().Mock().WithVerb("POST").WithPathf("/debug/flush").
+		WithHeader("Authorization", "Bearer test-token").JSON(&result)
+	assert.Nil(err)
+	assert.Equal(1, result.Succeeded)
+	assert.Equal(1, result.Failed)
+	assert.Equal(1, slack.Calls, "notifiers that succeeded aren't sent to again")
+	assert.Equal(2, pagerDuty.Calls)
+	assert.Equal(2, discord.Calls)
+
+	letters := deadLetters.Drain()
+	assert.Len(letters, 1)
+	assert.Equal(discord, letters[0].Notifier)
+	assert.Equal("discord is down", letters[0].Error)
+}
+
+func TestFlushKeepsFailures(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DEBUG_TOKEN", os.Getenv("DEBUG_TOKEN"))
+	os.Setenv("DEBUG_TOKEN", "test-token")
+
+	recorder := recordOutbound(http.StatusServiceUnavailable, "")
+	recorder.Err = fmt.Errorf("still down")
+	defer recorder.Restore()
+
+	deadLetters.Drain()
+	deadLetters.Add(&notification{Text: "one"}, fmt.Errorf("slack is down"))
+
+	var result flushResult
+	err := flushTestApp().Mock().WithVerb("POST").WithPathf("/debug/flush").
+		WithHeader("Authorization", "Bearer test-token").JSON(&result)
+	assert.Nil(err)
+	assert.Zero(result.Succeeded)
+	assert.Equal(1, result.Failed)
+	assert.Equal(1, deadLetters.Len())
+	deadLetters.Drain()
+}
+
+func TestFlushRequiresToken(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DEBUG_TOKEN", os.Getenv("DEBUG_TOKEN"))
+
+	os.Setenv("DEBUG_TOKEN", "")
+	res, err := flushTestApp().Mock().WithVerb("POST").WithPathf("/debug/flush").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusNotFound, res.StatusCode)
+
+	os.Setenv("DEBUG_TOKEN", "test-token")
+	res, err = flushTestApp().Mock().WithVerb("POST").WithPathf("/debug/flush").
+		WithHeader("Authorization", "Bearer wrong-token").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, res.StatusCode)
+}
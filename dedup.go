@@ -0,0 +1,114 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// webhookDedup is where `dedupWebhook` records the webhooks it has handled; it's in memory, so it's
+// per replica and forgotten on restart, until a shared store replaces it.
+var webhookDedup dedupStore = newMemoryDedupStore(time.Now)
+
+// dedupTTL returns how long a handled webhook is remembered, from `DEDUP_TTL`; webhooks aren't deduplicated if it's unset.
+func dedupTTL() time.Duration {
+	return envDuration("DEDUP_TTL", 0)
+}
+
+// dedupStore remembers keys for a while, so redelivered webhooks can be recognized.
+type dedupStore interface {
+	// SeenRecently returns if the key was marked within its ttl.
+	SeenRecently(key string) bool
+	// Mark remembers the key for `ttl`.
+	Mark(key string, ttl time.Duration)
+}
+
+// dedupWebhook acknowledges webhooks handled within `DEDUP_TTL` with a 200 without handling them again,
+// keyed by `X-Shopify-Webhook-Id` or else by `idempotencyKey()`. Only webhooks handled successfully are
+// remembered, so the sender's retries of failures still go through.
+func dedupWebhook(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		ttl := dedupTTL()
+		if ttl <= 0 {
+			return action(rc)
+		}
+
+		key := webhookDedupKey(rc)
+		if webhookDedup.SeenRecently(key) {
+			rc.Logger().Logf("dedupWebhook::skipping duplicate webhook `%s`.", key)
+			return rc.API().OK()
+		}
+		result := action(rc)
+		if resultStatusCode(result) < http.StatusBadRequest {
+			webhookDedup.Mark(key, ttl)
+		}
+		return result
+	}
+}
+
+// webhookDedupKey returns the key a webhook is deduplicated by.
+func webhookDedupKey(rc *web.RequestContext) string {
+	if id := strings.TrimSpace(rc.Request.Header.Get("X-Shopify-Webhook-Id")); len(id) != 0 {
+		return "id:" + id
+	}
+	topic := strings.ToLower(strings.TrimSpace(rc.Request.Header.Get("X-Shopify-Topic")))
+	if len(topic) == 0 {
+		topic = rc.Request.URL.Path
+	}
+	return "hash:" + idempotencyKey(topic, rc.PostBody())
+}
+
+func newMemoryDedupStore(now func() time.Time) *memoryDedupStore {
+	return &memoryDedupStore{now: now, expiries: map[string]time.Time{}}
+}
+
+// memoryDedupStore is a dedupStore in memory. Expired keys are swept as new ones are marked.
+type memoryDedupStore struct {
+	sync.Mutex
+	now       func() time.Time
+	expiries  map[string]time.Time
+	lastSweep time.Time
+}
+
+// SeenRecently implements dedupStore.
+func (mds *memoryDedupStore) SeenRecently(key string) bool {
+	mds.Lock()
+	defer mds.Unlock()
+
+	expiry, hasExpiry := mds.expiries[key]
+	if !hasExpiry {
+		return false
+	}
+	if !mds.now().Before(expiry) {
+		delete(mds.expiries, key)
+		return false
+	}
+	return true
+}
+
+// Mark implements dedupStore.
+func (mds *memoryDedupStore) Mark(key string, ttl time.Duration) {
+	mds.Lock()
+	defer mds.Unlock()
+
+	now := mds.now()
+	mds.expiries[key] = now.Add(ttl)
+	if now.Sub(mds.lastSweep) >= ttl {
+		for key, expiry := range mds.expiries {
+			if !now.Before(expiry) {
+				delete(mds.expiries, key)
+			}
+		}
+		mds.lastSweep = now
+	}
+}
+
+// Len returns the number of keys held, including any expired but not yet swept.
+func (mds *memoryDedupStore) Len() int {
+	mds.Lock()
+	defer mds.Unlock()
+	return len(mds.expiries)
+}
@@ -0,0 +1,122 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func TestMemoryDedupStore(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	store := newMemoryDedupStore(func() time.Time { return now })
+
+	assert.False(store.SeenRecently("a"))
+	store.Mark("a", time.Minute)
+	assert.True(store.SeenRecently("a"))
+	assert.False(store.SeenRecently("b"))
+
+	now = now.Add(59 * time.Second)
+	assert.True(store.SeenRecently("a"))
+	now = now.Add(time.Second)
+	assert.False(store.SeenRecently("a"), "keys expire after their ttl")
+	assert.Zero(store.Len(), "expired keys are dropped when they're checked")
+
+	store.Mark("b", time.Minute)
+	store.Mark("c", time.Hour)
+	now = now.Add(2 * time.Minute)
+	store.Mark("d", time.Minute)
+	assert.Equal(2, store.Len(), "expired keys are swept when new ones are marked")
+	assert.True(store.SeenRecently("c"))
+	assert.False(store.SeenRecently("b"))
+}
+
+// countingDedupStore wraps a dedupStore, recording the keys marked.
+type countingDedupStore struct {
+	dedupStore
+	Marked []string
+}
+
+func (cds *countingDedupStore) Mark(key string, ttl time.Duration) {
+	cds.Marked = append(cds.Marked, key)
+	cds.dedupStore.Mark(key, ttl)
+}
+
+func TestDedupWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DEDUP_TTL", os.Getenv("DEDUP_TTL"))
+	os.Setenv("DEDUP_TTL", "10m")
+	defer func(store dedupStore) { webhookDedup = store }(webhookDedup)
+	store := &countingDedupStore{dedupStore: newMemoryDedupStore(time.Now)}
+	webhookDedup = store
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 1}
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+	for x := 0; x < 2; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+			WithHeader("X-Shopify-Topic", "orders/create").WithHeader("X-Shopify-Webhook-Id", "b54557e4").Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+	assert.Len(captured.Requests(), 1, "redeliveries are acknowledged without notifying again")
+	assert.Equal([]string{"id:b54557e4"}, store.Marked)
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Topic", "orders/create").WithHeader("X-Shopify-Webhook-Id", "c2b16f10").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Len(captured.Requests(), 2, "webhooks are keyed by their id first")
+
+	for x := 0; x < 2; x++ {
+		res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+			WithHeader("X-Shopify-Topic", "orders/create").Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+	assert.Len(captured.Requests(), 3, "webhooks without an id are keyed by their content")
+	assert.Equal("hash:"+idempotencyKey("orders/create", body), store.Marked[2])
+
+	captured.StatusCode = http.StatusInternalServerError
+	failing := []byte(`{"id":450789470,"total_price":"8.00"}`)
+	for x := 0; x < 2; x++ {
+		res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(failing).
+			WithHeader("X-Shopify-Topic", "orders/create").Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusInternalServerError, res.StatusCode)
+	}
+	assert.Len(store.Marked, 3, "failures aren't remembered, so retries go through")
+}
+
+func TestDedupWebhookDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DEDUP_TTL", os.Getenv("DEDUP_TTL"))
+	os.Setenv("DEDUP_TTL", "")
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+	for x := 0; x < 2; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+			WithHeader("X-Shopify-Webhook-Id", "b54557e4").Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+	assert.Len(captured.Requests(), 2)
+}
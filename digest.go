@@ -0,0 +1,106 @@
+package main
+
+import (
+	"bytes"
+	"sync"
+	"time"
+)
+
+const (
+	// defaultShopperDigestThreshold is the fewest signups in a window posted as a digest rather than individually.
+	defaultShopperDigestThreshold = 3
+	// shopperDigestMaxLines is the most signups listed in a digest; the rest are counted.
+	shopperDigestMaxLines = 10
+)
+
+// shopperDigest coalesces waves of signups, like after a promo, into one message per
+// `SHOPPER_DIGEST_WINDOW`; signups are posted as they come if it's unset.
+var shopperDigest = newSignupDigest(envDuration("SHOPPER_DIGEST_WINDOW", 0), envInt("SHOPPER_DIGEST_THRESHOLD", defaultShopperDigestThreshold), notify)
+
+func newSignupDigest(window time.Duration, threshold int, send func(*notification) error) *signupDigest {
+	return &signupDigest{window: window, threshold: threshold, send: send}
+}
+
+// signupDigest holds signup notifications for a window after the first, then sends them individually
+// if there are fewer than the threshold, or as a single digest if not.
+type signupDigest struct {
+	sync.Mutex
+	window    time.Duration
+	threshold int
+	send      func(*notification) error
+	pending   []pendingSignup
+	timer     *time.Timer
+}
+
+// Enabled returns if signups are digested at all.
+func (sd *signupDigest) Enabled() bool {
+	return sd.window > 0
+}
+
+// pendingSignup is a signup's notification, and the line summarizing it in a digest.
+type pendingSignup struct {
+	Notification *notification
+	Line         string
+}
+
+// Add holds a signup until the window closes, starting the window if it's the first.
+func (sd *signupDigest) Add(n *notification, line string) {
+	sd.Lock()
+	defer sd.Unlock()
+
+	sd.pending = append(sd.pending, pendingSignup{Notification: n, Line: line})
+	if sd.timer == nil {
+		sd.timer = time.AfterFunc(sd.window, func() { sd.Flush() })
+	}
+}
+
+// Len returns the number of signups held.
+func (sd *signupDigest) Len() int {
+	sd.Lock()
+	defer sd.Unlock()
+	return len(sd.pending)
+}
+
+// Flush closes the window, sending the signups held. Failed sends are dead-lettered by `notify`, so
+// they aren't returned.
+func (sd *signupDigest) Flush() {
+	sd.Lock()
+	pending := sd.pending
+	sd.pending = nil
+	if sd.timer != nil {
+		sd.timer.Stop()
+		sd.timer = nil
+	}
+	sd.Unlock()
+
+	if len(pending) == 0 {
+		return
+	}
+	if len(pending) < sd.threshold {
+		for _, signup := range pending {
+			sd.send(signup.Notification)
+		}
+		return
+	}
+	sd.send(shopperDigestNotification(pending))
+}
+
+// shopperDigestNotification summarizes signups as one notification listing the first few.
+func shopperDigestNotification(signups []pendingSignup) *notification {
+	buffer := bytes.NewBuffer(nil)
+	buffer.WriteString(messagef(":busts_in_silhouette: %d New Shoppers!", len(signups)))
+	for index, signup := range signups {
+		if index == shopperDigestMaxLines {
+			buffer.WriteString(messagef("\n…and %d more", len(signups)-shopperDigestMaxLines))
+			break
+		}
+		buffer.WriteString("\n• " + signup.Line)
+	}
+	return &notification{
+		Topic:    "customers/create",
+		Text:     buffer.String(),
+		Username: "Shopify (New Customer)",
+		IconURL:  shopifyIconURL,
+		Payload:  map[string]interface{}{"count": len(signups)},
+	}
+}
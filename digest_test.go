@@ -0,0 +1,109 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+// sentNotifications returns a send func for a signupDigest, and the notifications it was sent.
+func sentNotifications() (func(*notification) error, func() []*notification) {
+	var mutex sync.Mutex
+	var sent []*notification
+	return func(n *notification) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			sent = append(sent, n)
+			return nil
+		}, func() []*notification {
+			mutex.Lock()
+			defer mutex.Unlock()
+			return append([]*notification{}, sent...)
+		}
+}
+
+func TestSignupDigestBurst(t *testing.T) {
+	assert := assert.New(t)
+
+	send, sent := sentNotifications()
+	digest := newSignupDigest(time.Hour, 3, send)
+	assert.True(digest.Enabled())
+
+	for x := 0; x < 12; x++ {
+		digest.Add(&notification{Text: "New Shopper Signup!"}, fmt.Sprintf("shopper%d@example.com", x))
+	}
+	assert.Equal(12, digest.Len())
+	assert.Empty(sent(), "nothing is sent until the window closes")
+
+	digest.Flush()
+	assert.Zero(digest.Len())
+	assert.Len(sent(), 1)
+	text := sent()[0].Text
+	assert.Contains(":busts_in_silhouette: 12 New Shoppers!", text)
+	assert.Contains("• shopper0@example.com", text)
+	assert.Contains("• shopper9@example.com", text)
+	assert.Contains("…and 2 more", text)
+	assert.Equal(12, sent()[0].Payload["count"])
+}
+
+func TestSignupDigestBelowThreshold(t *testing.T) {
+	assert := assert.New(t)
+
+	send, sent := sentNotifications()
+	digest := newSignupDigest(time.Hour, 3, send)
+	digest.Add(&notification{Text: "first"}, "first@example.com")
+	digest.Add(&notification{Text: "second"}, "second@example.com")
+	digest.Flush()
+
+	assert.Len(sent(), 2, "signups below the threshold are sent individually")
+	assert.Equal("first", sent()[0].Text)
+	assert.Equal("second", sent()[1].Text)
+
+	assert.False(newSignupDigest(0, 3, send).Enabled())
+}
+
+func TestSignupDigestWindow(t *testing.T) {
+	assert := assert.New(t)
+
+	flushed := make(chan *notification, 1)
+	digest := newSignupDigest(20*time.Millisecond, 2, func(n *notification) error {
+		flushed <- n
+		return nil
+	})
+	digest.Add(&notification{}, "first@example.com")
+	digest.Add(&notification{}, "second@example.com")
+
+	n := assert.ReceivesWithin(flushed, time.Second).(*notification)
+	assert.Contains("2 New Shoppers!", n.Text)
+	assert.Zero(digest.Len())
+}
+
+func TestShopperRouteDigest(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func(digest *signupDigest) { shopperDigest = digest }(shopperDigest)
+	shopperDigest = newSignupDigest(time.Hour, 3, notify)
+
+	app := newApp()
+	for x := 0; x < 5; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/shopper").
+			WithPostBody([]byte(fmt.Sprintf(`{"id":%d,"email":"shopper%d@example.com","first_name":"Bob","last_name":"Norman"}`, 207119551+x, x))).Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+	assert.Empty(captured.Requests())
+
+	shopperDigest.Flush()
+	assert.Len(captured.Requests(), 1)
+	var body map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &body))
+	assert.Contains("5 New Shoppers!", body["text"].(string))
+	assert.Contains("admin/customers/207119555|shopper4@example.com> Bob Norman", body["text"].(string))
+}
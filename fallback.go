@@ -0,0 +1,86 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/blendlabs/go-util"
+)
+
+// newConfiguredNotifier returns the notifier selected by `NOTIFIER`, falling back in order to those in
+// `NOTIFIER_FALLBACKS`, if any, for the topics in `FALLBACK_TOPICS` (every topic if unset). If
+// `SEVERITY_NOTIFIERS` is set, topics are routed by their severity first, and those without a route
+// go to the chain.
+func newConfiguredNotifier() (notifier, error) {
+	chain, err := newNotifierChain()
+	if err != nil {
+		return nil, err
+	}
+	if len(os.Getenv("SEVERITY_NOTIFIERS")) == 0 {
+		return chain, nil
+	}
+	return newSeverityNotifier(os.Getenv("TOPIC_SEVERITIES"), os.Getenv("SEVERITY_NOTIFIERS"), chain)
+}
+
+// newNotifierChain returns the notifier selected by `NOTIFIER` and its `NOTIFIER_FALLBACKS`.
+func newNotifierChain() (notifier, error) {
+	primary, err := newNotifier(os.Getenv("NOTIFIER"))
+	if err != nil {
+		return nil, err
+	}
+	names := util.ParseList(os.Getenv("NOTIFIER_FALLBACKS"))
+	if len(names) == 0 {
+		return primary, nil
+	}
+
+	chain := &fallbackNotifier{Notifiers: []notifier{primary}, Topics: util.ParseList(os.Getenv("FALLBACK_TOPICS"))}
+	for _, name := range names {
+		fallback, err := newNotifier(name)
+		if err != nil {
+			return nil, fmt.Errorf("`NOTIFIER_FALLBACKS`: %v", err)
+		}
+		chain.Notifiers = append(chain.Notifiers, fallback)
+	}
+	return chain, nil
+}
+
+// fallbackNotifier delivers notifications to the first of an ordered list of notifiers that accepts
+// them, retrying each per `deliveryRetryPolicy()` before moving to the next. Topics outside `Topics`,
+// when it's set, only go to the first.
+type fallbackNotifier struct {
+	Notifiers []notifier
+	Topics    []string
+}
+
+// Notify implements notifier. The chain has already retried every notifier, so its error is permanent.
+func (fn *fallbackNotifier) Notify(n *notification) error {
+	notifiers := fn.Notifiers
+	if !fn.fallsBack(n.Topic) {
+		notifiers = notifiers[:1]
+	}
+
+	var failures []string
+	for _, notifier := range notifiers {
+		err := deliveryRetryPolicy().Do(func() error {
+			return notifier.Notify(n)
+		})
+		if err == nil {
+			return nil
+		}
+		failures = append(failures, err.Error())
+	}
+	return permanent(fmt.Errorf("all %d notifiers failed: %s", len(notifiers), strings.Join(failures, "; ")))
+}
+
+func (fn *fallbackNotifier) fallsBack(topic string) bool {
+	if len(fn.Topics) == 0 {
+		return true
+	}
+	for _, fallbackTopic := range fn.Topics {
+		if strings.EqualFold(fallbackTopic, topic) {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,106 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+)
+
+// countingNotifier counts notifications, failing each with `Err` if it's set.
+type countingNotifier struct {
+	Err   error
+	Calls int
+}
+
+func (cn *countingNotifier) Notify(n *notification) error {
+	cn.Calls++
+	return cn.Err
+}
+
+func TestFallbackNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 2}
+
+	primary := &countingNotifier{Err: fmt.Errorf("slack is down")}
+	secondary := &countingNotifier{}
+	tertiary := &countingNotifier{}
+	chain := &fallbackNotifier{Notifiers: []notifier{primary, secondary, tertiary}}
+
+	assert.Nil(chain.Notify(&notification{Topic: "orders/create", Text: "New Sale!"}))
+	assert.Equal(2, primary.Calls, "the primary is retried before falling back")
+	assert.Equal(1, secondary.Calls)
+	assert.Zero(tertiary.Calls, "the chain stops at the first success")
+}
+
+func TestFallbackNotifierAllFail(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 2}
+	defer func(n notifier) { _notifier = n }(_notifier)
+	defer func() { deadLetters = newDeadLetterStore(deadLetterCapacity) }()
+	deadLetters = newDeadLetterStore(deadLetterCapacity)
+
+	primary := &countingNotifier{Err: fmt.Errorf("slack is down")}
+	secondary := &countingNotifier{Err: fmt.Errorf("discord is down")}
+	_notifier = &fallbackNotifier{Notifiers: []notifier{primary, secondary}}
+
+	err := deliver(&notification{Topic: "orders/create", Text: "New Sale!"}, deliveryRetryPolicy())
+	assert.NotNil(err)
+	assert.Contains("all 2 notifiers failed: slack is down; discord is down", err.Error())
+	assert.Equal(2, primary.Calls, "the chain isn't retried again as a whole")
+	assert.Equal(2, secondary.Calls)
+
+	letters := deadLetters.Drain()
+	assert.Len(letters, 1)
+	assert.Equal("New Sale!", letters[0].Notification.Text)
+}
+
+func TestFallbackNotifierTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 1}
+
+	primary := &countingNotifier{Err: fmt.Errorf("slack is down")}
+	secondary := &countingNotifier{}
+	chain := &fallbackNotifier{Notifiers: []notifier{primary, secondary}, Topics: []string{"orders/create"}}
+
+	assert.NotNil(chain.Notify(&notification{Topic: "customers/create"}))
+	assert.Zero(secondary.Calls, "topics outside the list don't fall back")
+	assert.Nil(chain.Notify(&notification{Topic: "Orders/Create"}))
+	assert.Equal(1, secondary.Calls)
+}
+
+func TestNewConfiguredNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("NOTIFIER", os.Getenv("NOTIFIER"))
+	defer os.Setenv("NOTIFIER_FALLBACKS", os.Getenv("NOTIFIER_FALLBACKS"))
+	defer os.Setenv("FALLBACK_TOPICS", os.Getenv("FALLBACK_TOPICS"))
+	os.Setenv("NOTIFIER", "stdout")
+	os.Setenv("FALLBACK_TOPICS", "orders/create, orders/cancelled")
+
+	os.Setenv("NOTIFIER_FALLBACKS", "")
+	n, err := newConfiguredNotifier()
+	assert.Nil(err)
+	_, isStdout := n.(*stdoutNotifier)
+	assert.True(isStdout)
+
+	os.Setenv("NOTIFIER_FALLBACKS", "stdout,stdout")
+	n, err = newConfiguredNotifier()
+	assert.Nil(err)
+	chain, isChain := n.(*fallbackNotifier)
+	assert.True(isChain)
+	assert.Len(chain.Notifiers, 3)
+	assert.Equal([]string{"orders/create", "orders/cancelled"}, chain.Topics)
+
+	os.Setenv("NOTIFIER_FALLBACKS", "carrier-pigeon")
+	_, err = newConfiguredNotifier()
+	assert.NotNil(err)
+	assert.Contains("NOTIFIER_FALLBACKS", err.Error())
+}
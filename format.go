@@ -0,0 +1,30 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"strconv"
+)
+
+// messagef formats a message like fmt.Sprintf, but renders numeric payload values in plain decimal.
+// Json decodes every number as a float64, which `%v` would format as `4.50789469e+08` for large ids.
+func messagef(format string, args ...interface{}) string {
+	formatted := make([]interface{}, len(args))
+	for index, arg := range args {
+		formatted[index] = formatNumber(arg)
+	}
+	return fmt.Sprintf(format, formatted...)
+}
+
+// formatNumber returns floats as plain decimal strings, and any other value as is.
+func formatNumber(value interface{}) interface{} {
+	switch typed := value.(type) {
+	case float64:
+		return strconv.FormatFloat(typed, 'f', -1, 64)
+	case float32:
+		return strconv.FormatFloat(float64(typed), 'f', -1, 32)
+	case json.Number:
+		return typed.String()
+	}
+	return value
+}
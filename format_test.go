@@ -0,0 +1,33 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestMessagef(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal("order 4507894690123 for 1234567.5", messagef("order %v for %v", float64(4507894690123), 1234567.5))
+	assert.Equal("price 19.99, qty 3", messagef("price %v, qty %v", 19.99, float64(3)))
+	assert.Equal("1000000000000000000000", messagef("%v", 1e21))
+	assert.Equal("text 12 <nil>", messagef("%s %v %v", "text", 12, nil))
+}
+
+func TestOrderTextLargeIDs(t *testing.T) {
+	assert := assert.New(t)
+
+	var order map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{
+		"id": 5620184391849,
+		"total_price": 1234567.89,
+		"customer": {"id": 7349251768402, "email": "shopper@example.com"}
+	}`), &order))
+
+	actual := orderText("kissandwear.com", order)
+	assert.Contains("admin/orders/5620184391849|Order 5620184391849 · 1234567.89 · shopper@example.com>", actual)
+	assert.False(strings.Contains(actual, "e+"))
+}
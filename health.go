@@ -0,0 +1,47 @@
+package main
+
+import (
+	"fmt"
+	"net/url"
+	"time"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// slackHealthTimeout bounds the slack connectivity check, so a hung health check doesn't outlive the prober's.
+const slackHealthTimeout = 2 * time.Second
+
+// healthResult is the response for the health endpoint.
+type healthResult struct {
+	Status string         `json:"status"`
+	Stats  *statsSnapshot `json:"stats"`
+}
+
+// healthzAction reports whether the slack webhook's host is reachable, with a 503 if it isn't, and
+// the request stats. Use `/` for load balancer checks that shouldn't depend on slack.
+func healthzAction(rc *web.RequestContext) web.ControllerResult {
+	if err := checkSlackReachable(slackWebhook()); err != nil {
+		rc.Logger().Errorf("healthz::checkSlackReachable() %v", err)
+		return rc.API().ServiceUnavailable()
+	}
+	return rc.JSON(&healthResult{Status: ok["status"], Stats: requestStats.Snapshot()})
+}
+
+// checkSlackReachable makes a `HEAD` request to the webhook's host; any response means it is reachable.
+// The webhook itself isn't requested, since that would post a message. An unset webhook isn't checked.
+func checkSlackReachable(webhook string) error {
+	if len(webhook) == 0 {
+		return nil
+	}
+	parsed, err := url.Parse(webhook)
+	if err != nil {
+		return err
+	}
+	if len(parsed.Host) == 0 {
+		return fmt.Errorf("slack webhook `%s` has no host", webhook)
+	}
+
+	host := &url.URL{Scheme: parsed.Scheme, Host: parsed.Host, Path: "/"}
+	_, err = outboundRequest(nil).WithVerb("HEAD").WithURL(host.String()).WithTimeout(slackHealthTimeout).ExecuteWithMeta()
+	return err
+}
@@ -0,0 +1,52 @@
+package main
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func TestHealthz(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(webhook string) { _slackWebhook = webhook }(_slackWebhook)
+	_slackWebhook = "https://hooks.slack.com/services/T000/B000/XXXX"
+
+	captured := recordOutbound(http.StatusMethodNotAllowed, "")
+	defer captured.Restore()
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	res, err := app.Mock().WithPathf("/healthz").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode, "any response from slack means it's reachable")
+	assert.Len(captured.Requests(), 1)
+	assert.Equal("HEAD", captured.Requests()[0].Verb)
+	assert.Equal("https://hooks.slack.com/", captured.Requests()[0].URL)
+
+	captured.Err = fmt.Errorf("dial tcp: lookup hooks.slack.com: no such host")
+	res, err = app.Mock().WithPathf("/healthz").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+
+	res, err = app.Mock().WithPathf("/").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode, "the root route doesn't check slack")
+	assert.Len(captured.Requests(), 2)
+}
+
+func TestCheckSlackReachable(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "")
+	defer captured.Restore()
+
+	assert.Nil(checkSlackReachable(""))
+	assert.NotNil(checkSlackReachable("hooks.slack.com/services/T000"))
+	assert.Empty(captured.Requests())
+}
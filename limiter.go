@@ -0,0 +1,124 @@
+package main
+
+import (
+	"math"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/blendlabs/go-util"
+	"github.com/wcharczuk/go-web"
+)
+
+// inflightRetryAfter is the `Retry-After`, in seconds, sent with requests shed by the in-flight limiter.
+const inflightRetryAfter = 5
+
+var _inflightLimiter *inflightLimiter
+
+// maxInflight returns the most webhooks handled at once from `MAX_INFLIGHT`, 0 (unlimited) if unset.
+func maxInflight() int {
+	return util.ParseInt(os.Getenv("MAX_INFLIGHT"))
+}
+
+// limitInflight sheds webhooks beyond `MAX_INFLIGHT` with a 503, so senders back off and retry later.
+func limitInflight(action web.ControllerAction) web.ControllerAction {
+	if _inflightLimiter == nil {
+		_inflightLimiter = newInflightLimiter(maxInflight())
+	}
+	return _inflightLimiter.Middleware(action)
+}
+
+func newInflightLimiter(limit int) *inflightLimiter {
+	return &inflightLimiter{limit: int32(limit)}
+}
+
+// inflightLimiter caps the number of requests handled at once across every route it wraps.
+type inflightLimiter struct {
+	limit    int32
+	inflight int32
+}
+
+// Inflight returns the number of requests currently being handled.
+func (il *inflightLimiter) Inflight() int {
+	return int(atomic.LoadInt32(&il.inflight))
+}
+
+// Middleware returns the action wrapped with the limiter; a limit of 0 or less doesn't limit.
+func (il *inflightLimiter) Middleware(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		if il.limit <= 0 {
+			return action(rc)
+		}
+
+		defer atomic.AddInt32(&il.inflight, -1)
+		if atomic.AddInt32(&il.inflight, 1) > il.limit {
+			rc.Response.Header().Set("Retry-After", strconv.Itoa(inflightRetryAfter))
+			return rc.API().ServiceUnavailable()
+		}
+		return action(rc)
+	}
+}
+
+// defaultRateLimitWindow is the window `RATE_LIMIT` counts webhooks over when `RATE_LIMIT_WINDOW` is unset.
+const defaultRateLimitWindow = time.Second
+
+var _rateLimiter *rateLimiter
+
+// limitRate sheds webhooks beyond `RATE_LIMIT` per `RATE_LIMIT_WINDOW` with a 429. The limit is a token
+// bucket, so a quiet sender can burst up to the whole window's count at once.
+func limitRate(action web.ControllerAction) web.ControllerAction {
+	if _rateLimiter == nil {
+		_rateLimiter = newRateLimiter(envInt("RATE_LIMIT", 0), envDuration("RATE_LIMIT_WINDOW", defaultRateLimitWindow), time.Now)
+	}
+	return _rateLimiter.Middleware(action)
+}
+
+// newRateLimiter returns a limiter allowing `limit` requests per `window`, starting full.
+func newRateLimiter(limit int, window time.Duration, now func() time.Time) *rateLimiter {
+	return &rateLimiter{limit: limit, window: window, now: now, tokens: float64(limit), last: now()}
+}
+
+// rateLimiter is a token bucket holding at most `limit` tokens, refilled at `limit` per `window`. Each
+// request takes a token, and is shed if there isn't one.
+type rateLimiter struct {
+	sync.Mutex
+	limit  int
+	window time.Duration
+	now    func() time.Time
+	tokens float64
+	last   time.Time
+}
+
+// Allow takes a token, returning false and how long until the next token if there isn't one.
+func (rl *rateLimiter) Allow() (bool, time.Duration) {
+	rl.Lock()
+	defer rl.Unlock()
+
+	now := rl.now()
+	if elapsed := now.Sub(rl.last); elapsed > 0 {
+		rl.tokens = math.Min(float64(rl.limit), rl.tokens+float64(rl.limit)*float64(elapsed)/float64(rl.window))
+	}
+	rl.last = now
+
+	if rl.tokens < 1 {
+		return false, time.Duration((1 - rl.tokens) * float64(rl.window) / float64(rl.limit))
+	}
+	rl.tokens--
+	return true, 0
+}
+
+// Middleware returns the action wrapped with the limiter; a limit or window of 0 or less doesn't limit.
+func (rl *rateLimiter) Middleware(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		if rl.limit <= 0 || rl.window <= 0 {
+			return action(rc)
+		}
+		if allowed, wait := rl.Allow(); !allowed {
+			rc.Response.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+			return rc.API().TooManyRequests()
+		}
+		return action(rc)
+	}
+}
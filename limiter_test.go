@@ -0,0 +1,166 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func TestInflightLimiterSheds(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := newInflightLimiter(1)
+	started, release := make(chan bool, 2), make(chan bool)
+
+	app := web.New()
+	app.POST("/order", func(rc *web.RequestContext) web.ControllerResult {
+		started <- true
+		<-release
+		return rc.JSON(ok)
+	}, limiter.Middleware)
+
+	done := make(chan int)
+	go func() {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").Response()
+		if err != nil {
+			done <- 0
+			return
+		}
+		done <- res.StatusCode
+	}()
+	assert.ReceivesWithin(started, time.Second)
+	assert.Equal(1, limiter.Inflight())
+
+	for x := 0; x < 3; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusServiceUnavailable, res.StatusCode)
+		assert.Equal("5", res.Header.Get("Retry-After"))
+	}
+	assert.Equal(1, limiter.Inflight())
+
+	close(release)
+	assert.Equal(http.StatusOK, assert.ReceivesWithin(done, time.Second))
+	assert.Equal(0, limiter.Inflight())
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+}
+
+func TestInflightLimiterUnlimited(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := newInflightLimiter(0)
+	app := web.New()
+	app.POST("/order", func(rc *web.RequestContext) web.ControllerResult {
+		return rc.JSON(ok)
+	}, limiter.Middleware)
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+}
+
+func TestRateLimiterPerMinute(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(6, time.Minute, func() time.Time { return now })
+
+	for x := 0; x < 6; x++ {
+		allowed, _ := limiter.Allow()
+		assert.True(allowed, "a quiet sender can burst the whole minute's count")
+	}
+	allowed, wait := limiter.Allow()
+	assert.False(allowed)
+	assert.Equal(10*time.Second, wait, "a token refills every 10 seconds")
+
+	now = now.Add(5 * time.Second)
+	allowed, wait = limiter.Allow()
+	assert.False(allowed)
+	assert.Equal(5*time.Second, wait)
+
+	now = now.Add(5 * time.Second)
+	allowed, _ = limiter.Allow()
+	assert.True(allowed)
+	allowed, _ = limiter.Allow()
+	assert.False(allowed, "one token refilled, one taken")
+
+	now = now.Add(time.Hour)
+	for x := 0; x < 6; x++ {
+		allowed, _ = limiter.Allow()
+		assert.True(allowed)
+	}
+	allowed, _ = limiter.Allow()
+	assert.False(allowed, "the bucket never holds more than the window's count")
+}
+
+func TestRateLimiterPerHour(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2, time.Hour, func() time.Time { return now })
+
+	limiter.Allow()
+	limiter.Allow()
+	allowed, wait := limiter.Allow()
+	assert.False(allowed)
+	assert.Equal(30*time.Minute, wait)
+
+	now = now.Add(15 * time.Minute)
+	allowed, wait = limiter.Allow()
+	assert.False(allowed)
+	assert.Equal(15*time.Minute, wait, "partial tokens carry over")
+}
+
+func TestRateLimiterMiddleware(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2026, 10, 16, 12, 0, 0, 0, time.UTC)
+	limiter := newRateLimiter(2, time.Minute, func() time.Time { return now })
+	app := web.New()
+	app.POST("/order", func(rc *web.RequestContext) web.ControllerResult {
+		return rc.JSON(ok)
+	}, limiter.Middleware)
+
+	for x := 0; x < 2; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal("30", res.Header.Get("Retry-After"))
+
+	now = now.Add(29*time.Second + 500*time.Millisecond)
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusTooManyRequests, res.StatusCode)
+	assert.Equal("1", res.Header.Get("Retry-After"), "waits are rounded up to whole seconds")
+
+	now = now.Add(time.Second)
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+}
+
+func TestRateLimiterUnlimited(t *testing.T) {
+	assert := assert.New(t)
+
+	limiter := newRateLimiter(0, time.Minute, time.Now)
+	app := web.New()
+	app.POST("/order", func(rc *web.RequestContext) web.ControllerResult {
+		return rc.JSON(ok)
+	}, limiter.Middleware)
+
+	for x := 0; x < 3; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+}
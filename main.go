@@ -4,64 +4,319 @@ import (
 	"crypto/hmac"
 	"crypto/sha256"
 	"encoding/base64"
+	"encoding/hex"
 	"fmt"
 	"log"
+	"net/http"
 	"os"
+	"os/signal"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
 
 	"github.com/blendlabs/go-request"
+	"github.com/blendlabs/go-util"
 	"github.com/wcharczuk/go-web"
 )
 
 var (
 	_sharedSecret []byte
 	_slackWebhook string
+	_slackClient  *request.Client
+
+	_slackClientOnce sync.Once
 )
 
 func slackWebhook() string {
 	if len(_slackWebhook) == 0 {
-		_slackWebhook = os.Getenv("SLACK_WEBHOOK")
+		_slackWebhook = canonicalSlackWebhook(os.Getenv("SLACK_WEBHOOK"))
 	}
 	return _slackWebhook
 }
 
+// canonicalizeSlackWebhook trims a slack webhook url and makes it https, adding the scheme if it's
+// missing, and returns an error if it still isn't a valid url. An empty webhook is left unset.
+func canonicalizeSlackWebhook(webhook string) (string, error) {
+	webhook = strings.TrimSpace(webhook)
+	if len(webhook) == 0 {
+		return "", nil
+	}
+
+	lowered := strings.ToLower(webhook)
+	if strings.HasPrefix(lowered, "http://") {
+		webhook = "https://" + webhook[len("http://"):]
+	} else if !strings.HasPrefix(lowered, "https://") {
+		if strings.Contains(webhook, "://") {
+			return "", fmt.Errorf("slack webhook `%s` must be an https url", webhook)
+		}
+		webhook = "https://" + webhook
+	}
+
+	if !util.IsURL(webhook) || strings.ContainsAny(webhook, " \t\n") {
+		return "", fmt.Errorf("slack webhook `%s` isn't a valid url", webhook)
+	}
+	return webhook, nil
+}
+
+// canonicalSlackWebhook returns the canonical form of a webhook validated by `validateSlackWebhooks`,
+// or the trimmed webhook if it's invalid.
+func canonicalSlackWebhook(webhook string) string {
+	canonical, err := canonicalizeSlackWebhook(webhook)
+	if err != nil {
+		return strings.TrimSpace(webhook)
+	}
+	return canonical
+}
+
+// validateSlackWebhooks returns an error naming the first of `SLACK_WEBHOOK` and the per-topic
+// webhooks that is set but isn't a valid url, so misconfiguration fails at startup rather than on delivery.
+func validateSlackWebhooks() error {
+	for _, name := range slackWebhookVariableNames() {
+		if _, err := canonicalizeSlackWebhook(os.Getenv(name)); err != nil {
+			return fmt.Errorf("`%s`: %v", name, err)
+		}
+	}
+	return nil
+}
+
+// slackWebhookVariables maps webhook topics to the environment variable naming the slack
+// webhook for them, so events can be routed to different channels.
+var slackWebhookVariables = map[string]string{
+	"orders/create":    "SLACK_WEBHOOK_ORDER",
+	"orders/cancelled": "SLACK_WEBHOOK_ORDER",
+	"refunds/create":   "SLACK_WEBHOOK_ORDER",
+	"customers/create": "SLACK_WEBHOOK_SHOPPER",
+	"products/update":  "SLACK_WEBHOOK_PRODUCT",
+}
+
+// slackWebhookVariableNames returns `SLACK_WEBHOOK` followed by the sorted topic webhook variables,
+// each once, though several topics can share a variable.
+func slackWebhookVariableNames() []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, name := range slackWebhookVariables {
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append([]string{"SLACK_WEBHOOK"}, names...)
+}
+
+// slackWebhookFor returns the slack webhook for a topic, falling back to `SLACK_WEBHOOK` if
+// the topic's own webhook isn't set.
+func slackWebhookFor(topic string) string {
+	if name, hasName := slackWebhookVariables[topic]; hasName {
+		if webhook := canonicalSlackWebhook(os.Getenv(name)); len(webhook) != 0 {
+			return webhook
+		}
+	}
+	return slackWebhook()
+}
+
+// slackClient returns the shared client for slack posts, capped at
+// `SLACK_MAX_CONCURRENCY` requests in flight (unlimited if unset), and at `SLACK_RETRY_RATE`
+// retries a second across every post, bursting to `SLACK_RETRY_BURST` (unlimited if unset).
+// It's built once, since deliveries can race to the first post, and two clients would each allow the cap.
+func slackClient() *request.Client {
+	_slackClientOnce.Do(func() {
+		if _slackClient != nil {
+			return
+		}
+		client := request.NewClient().WithMaxConcurrency(util.ParseInt(os.Getenv("SLACK_MAX_CONCURRENCY")))
+		if rate, err := strconv.ParseFloat(os.Getenv("SLACK_RETRY_RATE"), 64); err == nil && rate > 0 {
+			client.WithRetryBudget(request.NewRetryBudget(rate, envInt("SLACK_RETRY_BURST", defaultSlackRetryBurst)))
+		}
+		_slackClient = client
+	})
+	return _slackClient
+}
+
+// defaultSlackRetryBurst is the most retries the slack retry budget holds, when one is set.
+const defaultSlackRetryBurst = 10
+
 func sharedSecret() []byte {
 	if len(_sharedSecret) == 0 {
-		envSecret := os.Getenv("SHARED_SECRET")
-		_sharedSecret, _ = base64.StdEncoding.DecodeString(envSecret)
+		_sharedSecret, _ = parseSharedSecret(os.Getenv("SHARED_SECRET"))
 	}
 
 	return _sharedSecret
 }
 
+// requireSignature returns if `REQUIRE_SIGNATURE` is set, in which case the app
+// refuses to run without a shared secret rather than accepting unsigned webhooks.
+func requireSignature() bool {
+	required, _ := strconv.ParseBool(os.Getenv("REQUIRE_SIGNATURE"))
+	return required
+}
+
+// validateSharedSecret checks the configured secret at startup.
+func validateSharedSecret(encoded string, required bool) error {
+	secret, err := parseSharedSecret(encoded)
+	if err != nil {
+		return err
+	}
+	if required && len(secret) == 0 {
+		return fmt.Errorf("`REQUIRE_SIGNATURE` is set but `SHARED_SECRET` is not configured")
+	}
+	return nil
+}
+
+// parseSharedSecret decodes a base64 shared secret. A malformed secret is an error
+// rather than an empty secret, which would silently disable webhook verification.
+func parseSharedSecret(encoded string) ([]byte, error) {
+	if len(encoded) == 0 {
+		return nil, nil
+	}
+	secret, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `SHARED_SECRET`, must be base64 encoded: %v", err)
+	}
+	return secret, nil
+}
+
+// defaultHMACHeaderName is the header shopify sends webhook signatures in.
+const defaultHMACHeaderName = "X-Shopify-Hmac-Sha256"
+
+// hmacHeaderName returns the header webhook signatures are read from, `HMAC_HEADER_NAME` if set.
+// Header names are case-insensitive.
+func hmacHeaderName() string {
+	return util.EmptyCoalesce(strings.TrimSpace(os.Getenv("HMAC_HEADER_NAME")), defaultHMACHeaderName)
+}
+
+const (
+	signatureEncodingBase64 = "base64"
+	signatureEncodingHex    = "hex"
+)
+
+// signatureEncoding returns how webhook signatures are encoded from `SIGNATURE_ENCODING`, either
+// `base64` (the default, as Shopify sends) or `hex`.
+func signatureEncoding() string {
+	return strings.ToLower(util.EmptyCoalesce(os.Getenv("SIGNATURE_ENCODING"), signatureEncodingBase64))
+}
+
+// validateSignatureEncoding checks the configured signature encoding at startup.
+func validateSignatureEncoding(encoding string) error {
+	switch encoding {
+	case signatureEncodingBase64, signatureEncodingHex:
+		return nil
+	}
+	return fmt.Errorf("invalid `SIGNATURE_ENCODING`: %s, must be `base64` or `hex`", encoding)
+}
+
+// decodeSignature decodes a webhook signature with the given encoding.
+func decodeSignature(signature, encoding string) ([]byte, error) {
+	switch encoding {
+	case signatureEncodingBase64:
+		return base64.StdEncoding.DecodeString(signature)
+	case signatureEncodingHex:
+		return hex.DecodeString(signature)
+	}
+	return nil, validateSignatureEncoding(encoding)
+}
+
+// signatureScheme describes how a provider signs webhooks: the header the hmac-sha256 of the body is
+// sent in, its encoding, and any prefix before it, like github's `sha256=`.
+type signatureScheme struct {
+	HeaderName string
+	Encoding   string
+	Prefix     string
+}
+
+// shopifySignatureScheme is how shopify signs webhooks.
+var shopifySignatureScheme = signatureScheme{HeaderName: defaultHMACHeaderName, Encoding: signatureEncodingBase64}
+
+// configuredSignatureScheme returns the signature scheme from `HMAC_HEADER_NAME`, `SIGNATURE_ENCODING`
+// and `SIGNATURE_PREFIX`, which default to shopify's.
+func configuredSignatureScheme() signatureScheme {
+	return signatureScheme{
+		HeaderName: hmacHeaderName(),
+		Encoding:   signatureEncoding(),
+		Prefix:     os.Getenv("SIGNATURE_PREFIX"),
+	}
+}
+
+// verifyWebHook checks webhook signatures per `configuredSignatureScheme()`, read on each request.
 func verifyWebHook(action web.ControllerAction) web.ControllerAction {
 	return func(rc *web.RequestContext) web.ControllerResult {
-		if len(sharedSecret()) == 0 {
-			return action(rc)
-		}
+		return verifySignature(rc, configuredSignatureScheme(), action)
+	}
+}
 
-		shopifyHeader := rc.Request.Header.Get("HTTP_X_SHOPIFY_HMAC_SHA256")
-		if len(shopifyHeader) == 0 {
-			rc.Logger().Error("verifyHook::missing `HTTP_X_SHOPIFY_HMAC_SHA256` header.")
-			return rc.API().BadRequest("missing `HTTP_X_SHOPIFY_HMAC_SHA256` header.")
+// verifyWebHookWith returns middleware checking webhook signatures per a fixed scheme, for routes
+// taking webhooks from a provider other than the configured one.
+func verifyWebHookWith(scheme signatureScheme) web.ControllerMiddleware {
+	return func(action web.ControllerAction) web.ControllerAction {
+		return func(rc *web.RequestContext) web.ControllerResult {
+			return verifySignature(rc, scheme, action)
 		}
+	}
+}
 
-		compare, err := base64.StdEncoding.DecodeString(shopifyHeader)
-		if err != nil {
-			rc.Logger().Errorf("verifyHook::base64.DecodeString() %v", err)
-			return rc.API().BadRequest(err.Error())
+func verifySignature(rc *web.RequestContext, scheme signatureScheme, action web.ControllerAction) web.ControllerResult {
+	if len(sharedSecret()) == 0 {
+		if requireSignature() {
+			rc.Logger().Error("verifyHook::`REQUIRE_SIGNATURE` is set but no shared secret is configured.")
+			return rc.API().NotAuthorized()
 		}
+		return action(rc)
+	}
 
-		enc := hmac.New(sha256.New, sharedSecret())
-		enc.Write(rc.PostBody())
-		shouldBe := enc.Sum(nil)
+	headerName := scheme.HeaderName
+	signature := rc.Request.Header.Get(headerName)
+	if len(signature) == 0 {
+		rc.SetState(hmacValidStateKey, false)
+		rc.Logger().Errorf("verifyHook::missing `%s` header.", headerName)
+		hmacFailures.Inc(rc.Request.URL.Path)
+		hmacVerifications.Inc(verifyOutcomeMissingHeader)
+		return rc.API().BadRequest(fmt.Sprintf("missing `%s` header.", headerName))
+	}
+	if !strings.HasPrefix(signature, scheme.Prefix) {
+		rc.SetState(hmacValidStateKey, false)
+		rc.Logger().Errorf("verifyHook::`%s` header is missing the `%s` prefix.", headerName, scheme.Prefix)
+		hmacFailures.Inc(rc.Request.URL.Path)
+		hmacVerifications.Inc(verifyOutcomeMismatch)
+		return rc.API().BadRequest(fmt.Sprintf("invalid `%s` header.", headerName))
+	}
 
-		if !hmac.Equal(shouldBe, compare) {
-			rc.Logger().Error("verifyHook::invalid `HTTP_X_SHOPIFY_HMAC_SHA256` header.")
-			return rc.API().BadRequest("invalid `HTTP_X_SHOPIFY_HMAC_SHA256` header.")
-		}
+	compare, err := decodeSignature(strings.TrimPrefix(signature, scheme.Prefix), scheme.Encoding)
+	if err != nil {
+		rc.SetState(hmacValidStateKey, false)
+		rc.Logger().Errorf("verifyHook::decodeSignature() %v", err)
+		hmacFailures.Inc(rc.Request.URL.Path)
+		hmacVerifications.Inc(verifyOutcomeMismatch)
+		return rc.API().BadRequest(err.Error())
+	}
 
-		return action(rc)
+	enc := hmac.New(sha256.New, sharedSecret())
+	enc.Write(rc.PostBody())
+	shouldBe := enc.Sum(nil)
+
+	if !hmac.Equal(shouldBe, compare) {
+		rc.SetState(hmacValidStateKey, false)
+		rc.Logger().Errorf("verifyHook::invalid `%s` header.", headerName)
+		hmacFailures.Inc(rc.Request.URL.Path)
+		hmacVerifications.Inc(verifyOutcomeMismatch)
+		return rc.API().BadRequest(fmt.Sprintf("invalid `%s` header.", headerName))
 	}
+	rc.SetState(hmacValidStateKey, true)
+	hmacVerifications.Inc(verifyOutcomeSuccess)
+
+	return action(rc)
+}
+
+// idempotencyKey returns a stable key for a webhook from its topic and body, for
+// deduplicating deliveries from providers that don't send an `X-Shopify-Webhook-Id`.
+func idempotencyKey(topic string, body []byte) string {
+	hash := sha256.New()
+	hash.Write([]byte(topic))
+	hash.Write([]byte{0})
+	hash.Write(body)
+	return hex.EncodeToString(hash.Sum(nil))
 }
 
 var ok = map[string]string{"status": "ok!"}
@@ -70,88 +325,420 @@ func root(rc *web.RequestContext) web.ControllerResult {
 	return rc.JSON(ok)
 }
 
-func main() {
+func shopperAction(rc *web.RequestContext) web.ControllerResult {
+	parsed, err := decodePayload(rc.PostBody(), payloadDecodeLimits())
+	if err != nil {
+		return rc.API().BadRequest(err.Error())
+	}
+	line := shopperLine(shopDomain(rc), parsed)
+	n := &notification{
+		Topic: "customers/create",
+		Text: messagef(
+			`New Shopper Signup!
+                %s`,
+			line,
+		),
+		Username: "Shopify (New Customer)",
+		IconURL:  shopifyIconURL,
+		Payload:  allowedPayload(parsed),
+	}
+	if shopperDigest.Enabled() {
+		shopperDigest.Add(n, line)
+		return rc.JSON(ok)
+	}
+
+	if err = notify(n); err != nil {
+		return rc.API().InternalError(err)
+	}
+
+	return rc.JSON(ok)
+}
+
+// shopperLine links to a new shopper by email, followed by their name.
+func shopperLine(shop string, parsed map[string]interface{}) string {
+	parsed = allowedPayload(parsed)
+	return messagef(
+		"<%s|%v> %v %v",
+		adminLink(shop, "customers", parsed["id"]),
+		readMapAny(parsed, nil, [][]string{{"email"}, {"contact_email"}}),
+		parsed["first_name"],
+		parsed["last_name"],
+	)
+}
+
+func orderAction(rc *web.RequestContext) web.ControllerResult {
+	parsed, err := decodePayload(rc.PostBody(), payloadDecodeLimits())
+	if err != nil {
+		return rc.API().BadRequest(err.Error())
+	}
+	err = notify(&notification{
+		Topic:    "orders/create",
+		Text:     orderText(shopDomain(rc), parsed),
+		Username: "Shopify (New Customer)",
+		IconURL:  shopifyIconURL,
+		Payload:  allowedPayload(parsed),
+	})
+	if err != nil {
+		return rc.API().InternalError(err)
+	}
+
+	return rc.JSON(ok)
+}
+
+func orderCancelAction(rc *web.RequestContext) web.ControllerResult {
+	parsed, err := decodePayload(rc.PostBody(), payloadDecodeLimits())
+	if err != nil {
+		return rc.API().BadRequest(err.Error())
+	}
+	err = notify(&notification{
+		Topic:    "orders/cancelled",
+		Text:     orderCancelText(shopDomain(rc), parsed),
+		Username: "Shopify (Order Cancelled)",
+		IconURL:  shopifyIconURL,
+		Payload:  allowedPayload(parsed),
+	})
+	if err != nil {
+		return rc.API().InternalError(err)
+	}
+
+	return rc.JSON(ok)
+}
+
+// webhookMiddleware wraps every webhook route. The last listed runs first, so requests are logged and
+// counted whatever happens, size limited, decompressed and verified before anything else, deduplicated
+// once they're known to be genuine, and teed only once they're handled.
+var webhookMiddleware = []web.ControllerMiddleware{teeWebhook, limitInflight, limitRate, requireShopDomain, dedupWebhook, verifyWebHook, decodeContentEncoding, limitBodySize, collectStats, logWebhook}
+
+// newApp returns the app with its routes registered.
+func newApp() *web.App {
 	app := web.New()
 	app.SetName("Message Bus")
-	app.SetLogger(web.NewStandardOutputLogger())
+	app.SetMatchTrailingSlash(matchTrailingSlash())
 
 	app.GET("/", root)
+	app.GET("/healthz", healthzAction)
+	app.GET("/metrics", metricsAction)
+
+	app.POST("/shopper", shopperAction, webhookMiddleware...)
+	app.POST("/order", orderAction, webhookMiddleware...)
+	app.POST("/order/cancel", orderCancelAction, webhookMiddleware...)
+	app.POST("/refund", refundAction, webhookMiddleware...)
+	app.POST("/product", productAction, webhookMiddleware...)
+	app.POST("/cart", cartAction, webhookMiddleware...)
+	app.POST("/webhook", webhookAction, webhookMiddleware...)
+	app.POST("/debug/flush", flushAction, requireDebugToken)
+	return app
+}
+
+// topicActions are the actions `/webhook` dispatches to by the `X-Shopify-Topic` header; the
+// per-topic routes remain as aliases.
+var topicActions = map[string]web.ControllerAction{
+	"customers/create": shopperAction,
+	"orders/create":    orderAction,
+	"orders/cancelled": orderCancelAction,
+	"refunds/create":   refundAction,
+	"products/update":  productAction,
+	"carts/update":     cartAction,
+}
+
+// webhookAction handles every topic at one url, so shopify can point all webhooks at `/webhook`.
+// Topics without an action are acknowledged but not notified, so shopify doesn't retry them.
+func webhookAction(rc *web.RequestContext) web.ControllerResult {
+	topic := strings.ToLower(strings.TrimSpace(rc.Request.Header.Get("X-Shopify-Topic")))
+	if len(topic) == 0 {
+		return rc.API().BadRequest("`X-Shopify-Topic` header missing")
+	}
+	if action, hasAction := topicActions[topic]; hasAction {
+		return action(rc)
+	}
+	return rc.JSON(ok)
+}
+
+// matchTrailingSlash returns if routes also match with a trailing slash (`/order/`), which some
+// webhook providers append. It is on unless `MATCH_TRAILING_SLASH` is false.
+func matchTrailingSlash() bool {
+	match, err := strconv.ParseBool(os.Getenv("MATCH_TRAILING_SLASH"))
+	if err != nil {
+		return true
+	}
+	return match
+}
+
+func main() {
+	if err := validateSharedSecret(os.Getenv("SHARED_SECRET"), requireSignature()); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateSignatureEncoding(signatureEncoding()); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateSlackWebhooks(); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateDeliveryMode(deliveryMode()); err != nil {
+		log.Fatal(err)
+	}
+	if err := validateQueueFullPolicy(queueFullPolicy()); err != nil {
+		log.Fatal(err)
+	}
+
+	configuredNotifier, err := newConfiguredNotifier()
+	if err != nil {
+		log.Fatal(err)
+	}
+	_notifier = configuredNotifier
 
-	app.POST("/shopper", func(rc *web.RequestContext) web.ControllerResult {
-		var parsed map[string]interface{}
-		err := rc.PostBodyAsJSON(&parsed)
-		if err != nil {
-			return rc.API().BadRequest(err.Error())
+	_deliveryQueue = startDeliveryQueue(deliveryMode())
+
+	app := newApp()
+	app.SetLogger(web.NewStandardOutputLogger())
+	LogEffectiveConfig(app.Logger())
+
+	server := &http.Server{Addr: fmt.Sprintf(":%s", app.Port())}
+	stopped := make(chan struct{})
+	go func() {
+		defer close(stopped)
+		signals := make(chan os.Signal, 1)
+		signal.Notify(signals, os.Interrupt, syscall.SIGTERM)
+		<-signals
+
+		if err := drain(server, _deliveryQueue, shutdownTimeout()); err != nil {
+			app.Logger().Errorf("main::drain() %v", err)
 		}
+	}()
+
+	if err := app.StartWithServer(server); err != http.ErrServerClosed {
+		log.Fatal(err)
+	}
+	<-stopped
+}
+
+// fallbackShopDomain is the shop domain used when neither the webhook nor `SHOP_DOMAIN` names one.
+const fallbackShopDomain = "kissandwear.com"
+
+// shopDomainPattern matches valid shop domains, like `example.myshopify.com`.
+var shopDomainPattern = regexp.MustCompile(`^[a-z0-9]([a-z0-9-]*[a-z0-9])?(\.[a-z0-9]([a-z0-9-]*[a-z0-9])?)+$`)
+
+// defaultShopDomain returns the shop domain used for admin links when a webhook doesn't name one,
+// from `SHOP_DOMAIN`.
+func defaultShopDomain() string {
+	return util.EmptyCoalesce(os.Getenv("SHOP_DOMAIN"), fallbackShopDomain)
+}
+
+// shopDomain returns the shop the webhook came from per its `X-Shopify-Shop-Domain` header, so admin
+// links work for any store, falling back to `defaultShopDomain()` if it's missing or malformed.
+func shopDomain(rc *web.RequestContext) string {
+	domain := strings.ToLower(strings.TrimSpace(rc.Request.Header.Get("X-Shopify-Shop-Domain")))
+	if shopDomainPattern.MatchString(domain) {
+		return domain
+	}
+	return defaultShopDomain()
+}
+
+// allowedShopDomains returns the shops webhooks are accepted from, from `ALLOWED_SHOP_DOMAINS`,
+// separated by commas or newlines. An empty allowlist accepts any shop.
+func allowedShopDomains() []string {
+	return util.ParseList(os.Getenv("ALLOWED_SHOP_DOMAINS"))
+}
 
-		hookContents := map[string]interface{}{
-			"text": fmt.Sprintf(
-				`New Shopper Signup!
-                <https://kissandwear.com/admin/customers/%v|%v> %v %v`,
-				parsed["id"],
-				parsed["email"],
-				parsed["first_name"],
-				parsed["last_name"],
-			),
-			"username": "Shopify (New Customer)",
-			"icon_url": "https://support.wombat.co/hc/en-us/article_attachments/200579685/shopify-expert-web-designer.jpg",
+// requireShopDomain rejects webhooks whose `X-Shopify-Shop-Domain` header is missing or isn't in
+// `allowedShopDomains()`, with a 400. It does nothing if the allowlist is empty.
+func requireShopDomain(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		allowed := allowedShopDomains()
+		if len(allowed) == 0 {
+			return action(rc)
 		}
 
-		err = request.NewHTTPRequest().AsPost().WithURL(slackWebhook()).WithJSONBody(hookContents).Execute()
-		if err != nil {
-			return rc.API().InternalError(err)
+		domain := strings.TrimSpace(rc.Request.Header.Get("X-Shopify-Shop-Domain"))
+		if len(domain) == 0 {
+			rc.Logger().Error("requireShopDomain::missing `X-Shopify-Shop-Domain` header.")
+			return rc.API().BadRequest("missing `X-Shopify-Shop-Domain` header.")
 		}
+		for _, allowedDomain := range allowed {
+			if strings.EqualFold(domain, allowedDomain) {
+				return action(rc)
+			}
+		}
+		rc.Logger().Errorf("requireShopDomain::shop `%s` isn't allowed.", domain)
+		return rc.API().BadRequest(fmt.Sprintf("shop `%s` isn't allowed.", domain))
+	}
+}
 
-		return rc.JSON(ok)
-	}, verifyWebHook)
+// adminLink returns the url of a resource, like `orders`, in the shop's admin.
+func adminLink(shop, resource string, id interface{}) string {
+	return messagef("https://%s/admin/%s/%v", shop, resource, id)
+}
 
-	app.POST("/order", func(rc *web.RequestContext) web.ControllerResult {
-		var parsed map[string]interface{}
-		err := rc.PostBodyAsJSON(&parsed)
-		if err != nil {
-			return rc.API().BadRequest(err.Error())
+// defaultOrderEmoji leads order messages whose `financial_status` isn't mapped.
+const defaultOrderEmoji = ":moneybag:"
+
+// defaultFinancialStatusEmoji maps an order's `financial_status` to the emoji its message leads with.
+var defaultFinancialStatusEmoji = map[string]string{
+	"paid":    ":white_check_mark:",
+	"pending": ":hourglass_flowing_sand:",
+	"voided":  ":x:",
+}
+
+// financialStatusEmoji returns the status to emoji mapping from `FINANCIAL_STATUS_EMOJI`, formatted
+// like `paid=:white_check_mark:,refunded=:leftwards_arrow_with_hook:`, or the defaults if unset.
+func financialStatusEmoji() map[string]string {
+	configured := os.Getenv("FINANCIAL_STATUS_EMOJI")
+	if len(configured) == 0 {
+		return defaultFinancialStatusEmoji
+	}
+
+	mapping := map[string]string{}
+	for _, pair := range strings.Split(configured, ",") {
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			continue
+		}
+		status, emoji := strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1])
+		if len(status) != 0 && len(emoji) != 0 {
+			mapping[strings.ToLower(status)] = emoji
 		}
+	}
+	return mapping
+}
+
+// orderEmoji returns the emoji for the order's `financial_status`, or `defaultOrderEmoji`.
+func orderEmoji(parsed map[string]interface{}, mapping map[string]string) string {
+	status, _ := util.MapGetString(parsed, "financial_status")
+	if emoji, hasEmoji := mapping[strings.ToLower(status)]; hasEmoji {
+		return emoji
+	}
+	return defaultOrderEmoji
+}
+
+func orderText(shop string, parsed map[string]interface{}) string {
+	return messagef(
+		`%s New Sale!
+                <%s|%s>`,
+		orderEmoji(parsed, financialStatusEmoji()),
+		adminLink(shop, "orders", allowedPayload(parsed)["id"]),
+		summarizeOrder(parsed),
+	)
+}
+
+// orderCancelText formats a cancelled order; shopify sends a null `cancel_reason` when none was given.
+func orderCancelText(shop string, parsed map[string]interface{}) string {
+	echoed := allowedPayload(parsed)
+	reason, hasReason := util.MapGetString(echoed, "cancel_reason")
+	if !hasReason || len(reason) == 0 {
+		reason = "none given"
+	}
+	return messagef(
+		`:x: Order Cancelled!
+                <%s|%s> (reason: %s)`,
+		adminLink(shop, "orders", echoed["id"]),
+		summarizeOrder(parsed),
+		reason,
+	)
+}
+
+// summarizeOrder returns a one line summary of an order, like `Order #1001 · 12.50 USD · 3 items · Jane Doe`,
+// so every order message describes orders the same way. Parts missing from the payload are left out, and
+// orders without a customer are from a `Guest`. The item count is of the full payload, everything else
+// is echoed through `PAYLOAD_ALLOWLIST`.
+func summarizeOrder(parsed map[string]interface{}) string {
+	echoed := allowedPayload(parsed)
+	parts := []string{"Order"}
+	if name := readMapString(echoed, "name"); len(name) > 0 {
+		parts[0] = messagef("Order %s", name)
+	} else if id := readMapString(echoed, "id"); len(id) > 0 {
+		parts[0] = messagef("Order %s", id)
+	}
 
-		hookContents := map[string]interface{}{
-			"text": fmt.Sprintf(
-				`:moneybag: New Sale!
-                <https://kissandwear.com/admin/orders/%v|%v> for <http://kissandwear.com/admin/customers/%v|%v>`,
-				parsed["id"],
-				parsed["total_price"],
-				readMap(parsed, "customer", "id"),
-				readMap(parsed, "customer", "email"),
-			),
-			"username": "Shopify (New Customer)",
-			"icon_url": "https://support.wombat.co/hc/en-us/article_attachments/200579685/shopify-expert-web-designer.jpg",
+	if total := readMapMoney(echoed, "total_price"); len(total) > 0 {
+		if currency := readMapString(echoed, "currency"); len(currency) > 0 {
+			total = messagef("%s %s", total, currency)
 		}
+		parts = append(parts, total)
+	}
 
-		err = request.NewHTTPRequest().AsPost().WithURL(slackWebhook()).WithJSONBody(hookContents).Execute()
-		if err != nil {
-			return rc.API().InternalError(err)
+	if lineItems := readMapSlice(parsed, "line_items"); len(lineItems) > 0 {
+		var items int
+		for _, item := range lineItems {
+			items += readMapInt(item, "quantity")
+		}
+		if items == 1 {
+			parts = append(parts, "1 item")
+		} else {
+			parts = append(parts, messagef("%d items", items))
 		}
+	}
 
-		return rc.JSON(ok)
-	}, verifyWebHook)
+	return strings.Join(append(parts, orderCustomerName(echoed)), " · ")
+}
 
-	log.Fatal(app.Start())
+// orderCustomerName returns the name of the order's customer, their email if they have no name, or `Guest`.
+func orderCustomerName(parsed map[string]interface{}) string {
+	name := strings.TrimSpace(readMapString(parsed, "customer", "first_name") + " " + readMapString(parsed, "customer", "last_name"))
+	if len(name) > 0 {
+		return name
+	}
+	if email := readMapString(parsed, "customer", "email"); len(email) > 0 {
+		return email
+	}
+	return "Guest"
 }
 
+// readMap returns the value at `keys` in nested objects, where numeric keys index into arrays, like
+// `readMap(order, "line_items", "0", "title")`. It returns nil if any key along the path is missing,
+// out of range, or indexes something that isn't an object or array.
 func readMap(contents map[string]interface{}, keys ...string) interface{} {
-	var workingContents = contents
-	var result interface{}
-
-	for _, key := range keys {
-		if tempResult, hasResult := workingContents[key]; hasResult {
-			result = tempResult
-			if typed, isTyped := result.(map[string]interface{}); isTyped {
-				workingContents = typed
-			} else {
-				break
-			}
-		} else {
-			break
+	value, _ := util.MapGet(contents, keys...)
+	return value
+}
+
+// readMapString returns the value at `keys` as a string, or the empty string if it's missing, null or
+// not a scalar. Numbers are formatted in plain decimal, so ids don't render in scientific notation.
+func readMapString(contents map[string]interface{}, keys ...string) string {
+	value, _ := util.MapGetString(contents, keys...)
+	return value
+}
+
+// readMapFloat returns the value at `keys` as a float64, parsing numeric strings like shopify's
+// prices, or 0 if it's missing or isn't a number.
+func readMapFloat(contents map[string]interface{}, keys ...string) float64 {
+	value, _ := util.MapGetFloat(contents, keys...)
+	return value
+}
+
+// readMapInt returns the value at `keys` as an int, like `readMapFloat`, or 0 if it isn't a whole number.
+func readMapInt(contents map[string]interface{}, keys ...string) int {
+	value, _ := util.MapGetInt(contents, keys...)
+	return value
+}
+
+// readMapSlice returns the objects in the array at `keys`, for payload fields like an order's
+// `line_items` or a product's `variants`. Elements that aren't objects are skipped.
+func readMapSlice(contents map[string]interface{}, keys ...string) []map[string]interface{} {
+	value, hasValue := util.MapGet(contents, keys...)
+	if !hasValue {
+		return nil
+	}
+	elements, isSlice := value.([]interface{})
+	if !isSlice {
+		return nil
+	}
+
+	var results []map[string]interface{}
+	for _, element := range elements {
+		if typed, isTyped := element.(map[string]interface{}); isTyped {
+			results = append(results, typed)
 		}
 	}
+	return results
+}
 
-	return result
+// readMapAny returns the value at the first of `keyPaths` present in `contents`, or `defaultValue`
+// if none are. Shopify API versions differ on where some fields live (`email` vs `contact_email`).
+func readMapAny(contents map[string]interface{}, defaultValue interface{}, keyPaths [][]string) interface{} {
+	for _, keys := range keyPaths {
+		if value, hasValue := util.MapGet(contents, keys...); hasValue && value != nil {
+			return value
+		}
+	}
+	return defaultValue
 }
@@ -1,9 +1,21 @@
 package main
 
 import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
 	"testing"
 
 	"github.com/blendlabs/go-assert"
+	"github.com/blendlabs/go-request"
+	"github.com/wcharczuk/go-web"
 )
 
 func TestReadMap(t *testing.T) {
@@ -18,3 +30,706 @@ func TestReadMap(t *testing.T) {
 	actual := readMap(things, "foo", "bar")
 	assert.Equal("baz", actual)
 }
+
+func TestReadMapIndices(t *testing.T) {
+	assert := assert.New(t)
+
+	var order map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{
+		"line_items": [
+			{"title": "Example T-Shirt", "properties": [{"name": "size", "value": "M"}]},
+			{"title": "Example Hat"}
+		],
+		"customer": {"addresses": [{"city": "Ottawa"}]}
+	}`), &order))
+
+	assert.Equal("Example T-Shirt", readMap(order, "line_items", "0", "title"))
+	assert.Equal("Example Hat", readMap(order, "line_items", "1", "title"))
+	assert.Equal("M", readMap(order, "line_items", "0", "properties", "0", "value"))
+	assert.Equal("Ottawa", readMap(order, "customer", "addresses", "0", "city"))
+
+	assert.Nil(readMap(order, "line_items", "2", "title"))
+	assert.Nil(readMap(order, "line_items", "-1", "title"))
+	assert.Nil(readMap(order, "line_items", "first", "title"))
+	assert.Nil(readMap(order, "customer", "0"), "objects aren't indexed")
+	assert.Nil(readMap(order, "line_items", "0", "title", "0"), "strings aren't indexed")
+	assert.Nil(readMap(order, "customer", "email"))
+}
+
+func TestReadMapString(t *testing.T) {
+	assert := assert.New(t)
+
+	var order map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{"id":450789469123,"total_price":"12.50","email":null,"test":false,"line_items":[{"sku":"TS-M"}]}`), &order))
+
+	assert.Equal("450789469123", readMapString(order, "id"))
+	assert.Equal("12.50", readMapString(order, "total_price"))
+	assert.Equal("false", readMapString(order, "test"))
+	assert.Equal("TS-M", readMapString(order, "line_items", "0", "sku"))
+	assert.Empty(readMapString(order, "email"))
+	assert.Empty(readMapString(order, "customer", "email"))
+}
+
+func TestReadMapFloat(t *testing.T) {
+	assert := assert.New(t)
+
+	var order map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{"total_price":"12.50","total_weight":250.5,"currency":"CAD","line_items":[{"price":"4.25"}]}`), &order))
+
+	assert.Equal(12.5, readMapFloat(order, "total_price"))
+	assert.Equal(250.5, readMapFloat(order, "total_weight"))
+	assert.Equal(4.25, readMapFloat(order, "line_items", "0", "price"))
+	assert.Zero(readMapFloat(order, "currency"))
+	assert.Zero(readMapFloat(order, "subtotal_price"))
+}
+
+func TestReadMapInt(t *testing.T) {
+	assert := assert.New(t)
+
+	var order map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{"id":450789469123,"order_number":"1001","total_weight":250.5,"line_items":[{"quantity":2}]}`), &order))
+
+	assert.Equal(450789469123, readMapInt(order, "id"))
+	assert.Equal(1001, readMapInt(order, "order_number"))
+	assert.Equal(2, readMapInt(order, "line_items", "0", "quantity"))
+	assert.Zero(readMapInt(order, "total_weight"), "fractional values aren't ints")
+	assert.Zero(readMapInt(order, "customer", "id"))
+}
+
+func TestReadMapAny(t *testing.T) {
+	assert := assert.New(t)
+
+	things := map[string]interface{}{
+		"contact_email": "shopper@example.com",
+		"customer": map[string]interface{}{
+			"id": 5678,
+		},
+	}
+
+	actual := readMapAny(things, "default", [][]string{{"email"}, {"customer", "email"}, {"contact_email"}})
+	assert.Equal("shopper@example.com", actual)
+
+	actual = readMapAny(things, "default", [][]string{{"customer", "id"}, {"contact_email"}})
+	assert.Equal(5678, actual)
+}
+
+func TestReadMapAnyDefault(t *testing.T) {
+	assert := assert.New(t)
+
+	things := map[string]interface{}{
+		"email": nil,
+		"customer": map[string]interface{}{
+			"id": 5678,
+		},
+	}
+
+	actual := readMapAny(things, "default", [][]string{{"email"}, {"customer", "email"}, {"customer", "id", "email"}})
+	assert.Equal("default", actual)
+	assert.Equal("default", readMapAny(things, "default", nil))
+}
+
+func TestCanonicalizeSlackWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	valid := map[string]string{
+		"https://hooks.slack.com/services/T000/B000/XXXX":     "https://hooks.slack.com/services/T000/B000/XXXX",
+		"  https://hooks.slack.com/services/T000/B000/XXXX\n": "https://hooks.slack.com/services/T000/B000/XXXX",
+		"hooks.slack.com/services/T000/B000/XXXX":             "https://hooks.slack.com/services/T000/B000/XXXX",
+		"http://hooks.slack.com/services/T000/B000/XXXX":      "https://hooks.slack.com/services/T000/B000/XXXX",
+		"HTTPS://hooks.slack.com/services/T000/B000/XXXX":     "HTTPS://hooks.slack.com/services/T000/B000/XXXX",
+		"":    "",
+		"   ": "",
+	}
+	for webhook, expected := range valid {
+		canonical, err := canonicalizeSlackWebhook(webhook)
+		assert.Nil(err, webhook)
+		assert.Equal(expected, canonical, webhook)
+	}
+
+	for _, webhook := range []string{
+		"ftp://hooks.slack.com/services/T000",
+		"https://",
+		"https:///services/T000",
+		"hooks.slack.com/services/T000 B000",
+		"://hooks.slack.com",
+	} {
+		_, err := canonicalizeSlackWebhook(webhook)
+		assert.NotNil(err, webhook)
+	}
+}
+
+func TestValidateSlackWebhooks(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("SLACK_WEBHOOK", os.Getenv("SLACK_WEBHOOK"))
+	defer os.Setenv("SLACK_WEBHOOK_ORDER", os.Getenv("SLACK_WEBHOOK_ORDER"))
+	os.Setenv("SLACK_WEBHOOK", " hooks.slack.com/services/T000/B000/XXXX ")
+	os.Setenv("SLACK_WEBHOOK_ORDER", "")
+	assert.Nil(validateSlackWebhooks())
+
+	os.Setenv("SLACK_WEBHOOK_ORDER", "ftp://hooks.slack.com/services/sales")
+	err := validateSlackWebhooks()
+	assert.NotNil(err)
+	assert.Contains("SLACK_WEBHOOK_ORDER", err.Error())
+
+	defer func(webhook string) { _slackWebhook = webhook }(_slackWebhook)
+	_slackWebhook = ""
+	assert.Equal("https://hooks.slack.com/services/T000/B000/XXXX", slackWebhook())
+}
+
+func TestSlackWebhookVariableNames(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Equal([]string{"SLACK_WEBHOOK", "SLACK_WEBHOOK_ORDER", "SLACK_WEBHOOK_PRODUCT", "SLACK_WEBHOOK_SHOPPER"}, slackWebhookVariableNames())
+}
+
+func TestSlackWebhookFor(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("SLACK_WEBHOOK_ORDER", os.Getenv("SLACK_WEBHOOK_ORDER"))
+	defer os.Setenv("SLACK_WEBHOOK_SHOPPER", os.Getenv("SLACK_WEBHOOK_SHOPPER"))
+	defer func(webhook string) { _slackWebhook = webhook }(_slackWebhook)
+	_slackWebhook = "https://hooks.slack.com/services/default"
+
+	os.Setenv("SLACK_WEBHOOK_ORDER", "https://hooks.slack.com/services/sales")
+	os.Setenv("SLACK_WEBHOOK_SHOPPER", "")
+
+	assert.Equal("https://hooks.slack.com/services/sales", slackWebhookFor("orders/create"))
+	assert.Equal("https://hooks.slack.com/services/sales", slackWebhookFor("orders/cancelled"))
+	assert.Equal("https://hooks.slack.com/services/default", slackWebhookFor("customers/create"))
+	assert.Equal("https://hooks.slack.com/services/default", slackWebhookFor("app/uninstalled"))
+
+	os.Setenv("SLACK_WEBHOOK_SHOPPER", "https://hooks.slack.com/services/growth")
+	assert.Equal("https://hooks.slack.com/services/growth", slackWebhookFor("customers/create"))
+}
+
+func TestSlackClientBuiltOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("SLACK_MAX_CONCURRENCY", os.Getenv("SLACK_MAX_CONCURRENCY"))
+	os.Setenv("SLACK_MAX_CONCURRENCY", "2")
+	defer func(client *request.Client) {
+		_slackClient, _slackClientOnce = client, sync.Once{}
+	}(_slackClient)
+	_slackClient, _slackClientOnce = nil, sync.Once{}
+
+	clients := make(chan *request.Client, 8)
+	var wg sync.WaitGroup
+	for index := 0; index < cap(clients); index++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			clients <- slackClient()
+		}()
+	}
+	wg.Wait()
+	close(clients)
+
+	first := <-clients
+	assert.NotNil(first)
+	assert.Equal(2, first.MaxConcurrency())
+	for client := range clients {
+		assert.True(client == first, "every caller gets the same client")
+	}
+}
+
+func TestOrderTextWithCustomer(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{
+		"id":          1234,
+		"total_price": "12.50",
+		"customer": map[string]interface{}{
+			"id":    5678,
+			"email": "shopper@example.com",
+		},
+	}
+
+	actual := orderText("kissandwear.com", order)
+	assert.Contains("<https://kissandwear.com/admin/orders/1234|Order 1234 · 12.50 · shopper@example.com>", actual)
+	assert.False(strings.Contains(actual, "Guest"))
+}
+
+func TestOrderTextGuestCheckout(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{
+		"id":          1234,
+		"total_price": "12.50",
+	}
+
+	actual := orderText("kissandwear.com", order)
+	assert.Contains("· Guest>", actual)
+	assert.False(strings.Contains(actual, "<nil>"))
+	assert.False(strings.Contains(actual, "admin/customers"))
+}
+
+func TestOrderTextShopDomain(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{
+		"id":          1234,
+		"total_price": "12.50",
+		"customer": map[string]interface{}{
+			"id":    5678,
+			"email": "shopper@example.com",
+		},
+	}
+
+	actual := orderText("other-store.myshopify.com", order)
+	assert.Contains("<https://other-store.myshopify.com/admin/orders/1234|Order 1234 · 12.50 · shopper@example.com>", actual)
+	assert.False(strings.Contains(actual, "kissandwear.com"))
+}
+
+func TestSummarizeOrder(t *testing.T) {
+	assert := assert.New(t)
+
+	var full map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{
+		"id": 5620184391849,
+		"name": "#1001",
+		"total_price": "1234.50",
+		"currency": "USD",
+		"line_items": [{"title": "Socks", "quantity": 2}, {"title": "Hat", "quantity": 1}],
+		"customer": {"id": 7349251768402, "email": "jane@example.com", "first_name": "Jane", "last_name": "Doe"}
+	}`), &full))
+	assert.Equal("Order #1001 · 1234.50 USD · 3 items · Jane Doe", summarizeOrder(full))
+
+	var guest map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{
+		"id": 5620184391849,
+		"total_price": 19.99,
+		"line_items": [{"title": "Socks", "quantity": 1}]
+	}`), &guest))
+	assert.Equal("Order 5620184391849 · 19.99 · 1 item · Guest", summarizeOrder(guest))
+
+	assert.Equal("Order 1234 · shopper@example.com", summarizeOrder(map[string]interface{}{
+		"id":       1234,
+		"customer": map[string]interface{}{"email": "shopper@example.com"},
+	}), "customers without a name are shown by email")
+	assert.Equal("Order · Guest", summarizeOrder(map[string]interface{}{}))
+
+	assert.Contains(summarizeOrder(full), orderText("kissandwear.com", full))
+	assert.Contains(summarizeOrder(full), orderCancelText("kissandwear.com", full))
+}
+
+func TestShopDomain(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Setenv("SHOP_DOMAIN", os.Getenv("SHOP_DOMAIN"))
+	os.Setenv("SHOP_DOMAIN", "")
+
+	var domain string
+	app := web.New()
+	app.POST("/hook", func(rc *web.RequestContext) web.ControllerResult {
+		domain = shopDomain(rc)
+		return rc.JSON(ok)
+	})
+
+	assert.Nil(app.Mock().WithVerb("POST").WithPathf("/hook").WithHeader("X-Shopify-Shop-Domain", "Example.myshopify.com").Execute())
+	assert.Equal("example.myshopify.com", domain)
+
+	assert.Nil(app.Mock().WithVerb("POST").WithPathf("/hook").Execute())
+	assert.Equal(fallbackShopDomain, domain)
+
+	os.Setenv("SHOP_DOMAIN", "shop.example.com")
+	assert.Nil(app.Mock().WithVerb("POST").WithPathf("/hook").WithHeader("X-Shopify-Shop-Domain", "evil.com|click here>").Execute())
+	assert.Equal("shop.example.com", domain)
+}
+
+func TestRequireShopDomain(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer os.Setenv("ALLOWED_SHOP_DOMAINS", os.Getenv("ALLOWED_SHOP_DOMAINS"))
+	os.Setenv("ALLOWED_SHOP_DOMAINS", "kissandwear.myshopify.com, kissandwear.com")
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Shop-Domain", "KissAndWear.myshopify.com").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Len(captured.Requests(), 1)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Shop-Domain", "someone-else.myshopify.com").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+	assert.Len(captured.Requests(), 1)
+
+	os.Setenv("ALLOWED_SHOP_DOMAINS", "")
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode, "any shop is allowed without an allowlist")
+}
+
+func TestOrderCancelRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order/cancel").
+		WithPostBody([]byte(`{"id":450789469,"total_price":"12.50","cancel_reason":"customer"}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order/cancel").
+		WithPostBody([]byte(`{"id":450789469,"total_price":"12.50","cancel_reason":null}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	assert.Len(captured.Requests(), 2)
+	var withReason, withoutReason map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &withReason))
+	assert.Nil(json.Unmarshal(captured.Requests()[1].Body, &withoutReason))
+
+	assert.Contains(":x: Order Cancelled!", withReason["text"].(string))
+	assert.Contains("<https://kissandwear.com/admin/orders/450789469|Order 450789469 · 12.50 · Guest> (reason: customer)", withReason["text"].(string))
+	assert.Contains("(reason: none given)", withoutReason["text"].(string))
+	assert.False(strings.Contains(withoutReason["text"].(string), "<nil>"))
+}
+
+func TestWebhookDispatchesByTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func() { variantSnapshots = newVariantSnapshotStore() }()
+	variantSnapshots = newVariantSnapshotStore()
+
+	app := newApp()
+	deliveries := []struct {
+		Topic string
+		Body  string
+	}{
+		{"orders/create", `{"id":450789469,"total_price":"12.50"}`},
+		{"customers/create", `{"id":207119551,"email":"bob.norman@example.com"}`},
+		{"orders/cancelled", `{"id":450789469,"total_price":"12.50","cancel_reason":"customer"}`},
+		{"products/update", sampleProductUpdate},
+		{"Products/Update", strings.Replace(sampleProductUpdate, `"inventory_quantity": 50`, `"inventory_quantity": 48`, 1)},
+	}
+	for _, delivery := range deliveries {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/webhook").WithHeader("X-Shopify-Topic", delivery.Topic).
+			WithPostBody([]byte(delivery.Body)).Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode, delivery.Topic)
+	}
+
+	// the first product update has nothing to diff against, so it isn't notified.
+	requests := captured.Requests()
+	assert.Len(requests, 4)
+	texts := make([]string, len(requests))
+	for index, req := range requests {
+		var body map[string]interface{}
+		assert.Nil(json.Unmarshal(req.Body, &body))
+		texts[index] = body["text"].(string)
+	}
+	assert.Contains("Sale!", texts[0])
+	assert.Contains("bob.norman@example.com", texts[1])
+	assert.Contains(":x: Order Cancelled!", texts[2])
+	assert.Contains(":package: Product Updated!", texts[3])
+}
+
+func TestWebhookUnknownTopic(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	res, err := app.Mock().WithVerb("POST").WithPathf("/webhook").WithHeader("X-Shopify-Topic", "app/uninstalled").
+		WithPostBody([]byte(`{"id":1}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/webhook").WithPostBody([]byte(`{"id":1}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+	assert.Empty(captured.Requests())
+}
+
+func TestOrderEmoji(t *testing.T) {
+	assert := assert.New(t)
+
+	mapping := map[string]string{"paid": ":white_check_mark:", "pending": ":hourglass:", "voided": ":x:"}
+	assert.Equal(":white_check_mark:", orderEmoji(map[string]interface{}{"financial_status": "paid"}, mapping))
+	assert.Equal(":hourglass:", orderEmoji(map[string]interface{}{"financial_status": "PENDING"}, mapping))
+	assert.Equal(":x:", orderEmoji(map[string]interface{}{"financial_status": "voided"}, mapping))
+	assert.Equal(defaultOrderEmoji, orderEmoji(map[string]interface{}{"financial_status": "partially_refunded"}, mapping))
+	assert.Equal(defaultOrderEmoji, orderEmoji(map[string]interface{}{}, mapping))
+}
+
+func TestFinancialStatusEmoji(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Setenv("FINANCIAL_STATUS_EMOJI", os.Getenv("FINANCIAL_STATUS_EMOJI"))
+
+	os.Setenv("FINANCIAL_STATUS_EMOJI", "")
+	assert.Equal(defaultFinancialStatusEmoji, financialStatusEmoji())
+
+	os.Setenv("FINANCIAL_STATUS_EMOJI", "Paid=:tada:, refunded = :leftwards_arrow_with_hook:,bogus")
+	mapping := financialStatusEmoji()
+	assert.Len(mapping, 2)
+	assert.Equal(":tada:", mapping["paid"])
+	assert.Equal(":leftwards_arrow_with_hook:", mapping["refunded"])
+
+	actual := orderText("kissandwear.com", map[string]interface{}{"id": 1234, "total_price": "12.50", "financial_status": "paid"})
+	assert.True(strings.HasPrefix(actual, ":tada: New Sale!"))
+
+	actual = orderText("kissandwear.com", map[string]interface{}{"id": 1234, "total_price": "12.50", "financial_status": "voided"})
+	assert.True(strings.HasPrefix(actual, ":moneybag: New Sale!"))
+}
+
+func TestParseSharedSecret(t *testing.T) {
+	assert := assert.New(t)
+
+	secret, err := parseSharedSecret(base64.StdEncoding.EncodeToString([]byte("shhh")))
+	assert.Nil(err)
+	assert.Equal("shhh", string(secret))
+
+	secret, err = parseSharedSecret("")
+	assert.Nil(err)
+	assert.Empty(secret)
+}
+
+func TestParseSharedSecretInvalid(t *testing.T) {
+	assert := assert.New(t)
+
+	secret, err := parseSharedSecret("not base64!")
+	assert.NotNil(err)
+	assert.Contains("SHARED_SECRET", err.Error())
+	assert.Empty(secret)
+}
+
+func TestValidateSharedSecret(t *testing.T) {
+	assert := assert.New(t)
+
+	encoded := base64.StdEncoding.EncodeToString([]byte("shhh"))
+
+	// fail-open
+	assert.Nil(validateSharedSecret("", false))
+	assert.Nil(validateSharedSecret(encoded, false))
+
+	// fail-closed
+	assert.NotNil(validateSharedSecret("", true))
+	assert.Nil(validateSharedSecret(encoded, true))
+	assert.NotNil(validateSharedSecret("not base64!", true))
+}
+
+func TestVerifyWebHookRequireSignature(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("REQUIRE_SIGNATURE", os.Getenv("REQUIRE_SIGNATURE"))
+	defer os.Setenv("SHARED_SECRET", os.Getenv("SHARED_SECRET"))
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = nil
+	os.Setenv("SHARED_SECRET", "")
+
+	app := web.New()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	app.POST("/hook", func(rc *web.RequestContext) web.ControllerResult {
+		return rc.JSON(ok)
+	}, verifyWebHook)
+
+	os.Setenv("REQUIRE_SIGNATURE", "false")
+	res, err := app.Mock().WithVerb("POST").WithPathf("/hook").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	os.Setenv("REQUIRE_SIGNATURE", "true")
+	res, err = app.Mock().WithVerb("POST").WithPathf("/hook").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusForbidden, res.StatusCode)
+}
+
+func TestVerifyWebHookSignatureEncodings(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("SIGNATURE_ENCODING", os.Getenv("SIGNATURE_ENCODING"))
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+
+	app := web.New()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	app.POST("/hook", func(rc *web.RequestContext) web.ControllerResult {
+		return rc.JSON(ok)
+	}, verifyWebHook)
+
+	body := []byte(`{"id":1234}`)
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write(body)
+	signature := mac.Sum(nil)
+
+	send := func(header string) int {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/hook").WithPostBody(body).
+			WithHeader("X-Shopify-Hmac-Sha256", header).Response()
+		assert.Nil(err)
+		return res.StatusCode
+	}
+
+	os.Setenv("SIGNATURE_ENCODING", "")
+	assert.Equal(http.StatusOK, send(base64.StdEncoding.EncodeToString(signature)))
+	assert.Equal(http.StatusBadRequest, send(hex.EncodeToString(signature)))
+
+	os.Setenv("SIGNATURE_ENCODING", "hex")
+	assert.Equal(http.StatusOK, send(hex.EncodeToString(signature)))
+	assert.Equal(http.StatusBadRequest, send(base64.StdEncoding.EncodeToString(signature)))
+
+	signature[0] ^= 0xff
+	assert.Equal(http.StatusBadRequest, send(hex.EncodeToString(signature)))
+}
+
+func TestVerifyWebHookHeader(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("HMAC_HEADER_NAME", os.Getenv("HMAC_HEADER_NAME"))
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+	os.Setenv("HMAC_HEADER_NAME", "")
+
+	app := web.New()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	body := []byte(`{"id":1234}`)
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	var ran bool
+	action := verifyWebHook(func(rc *web.RequestContext) web.ControllerResult {
+		ran = true
+		return rc.JSON(ok)
+	})
+
+	rc, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Hmac-Sha256", signature).AsRequestContext(nil)
+	assert.Nil(err)
+	action(rc)
+	assert.True(ran)
+
+	ran = false
+	rc, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString([]byte("forged"))).AsRequestContext(nil)
+	assert.Nil(err)
+	result, isJSON := action(rc).(*web.JSONResult)
+	assert.True(isJSON)
+	assert.Equal(http.StatusBadRequest, result.StatusCode)
+	assert.False(ran)
+
+	os.Setenv("HMAC_HEADER_NAME", "x-provider-signature")
+	rc, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Provider-Signature", signature).AsRequestContext(nil)
+	assert.Nil(err)
+	action(rc)
+	assert.True(ran)
+}
+
+func TestVerifyWebHookWith(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+
+	githubSignatureScheme := signatureScheme{HeaderName: "X-Hub-Signature-256", Encoding: signatureEncodingHex, Prefix: "sha256="}
+
+	app := web.New()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	app.POST("/shopify", func(rc *web.RequestContext) web.ControllerResult {
+		return rc.JSON(ok)
+	}, verifyWebHookWith(shopifySignatureScheme))
+	app.POST("/github", func(rc *web.RequestContext) web.ControllerResult {
+		return rc.JSON(ok)
+	}, verifyWebHookWith(githubSignatureScheme))
+
+	body := []byte(`{"id":1234}`)
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write(body)
+	signature := mac.Sum(nil)
+
+	send := func(path, headerName, header string) int {
+		res, err := app.Mock().WithVerb("POST").WithPathf("%s", path).WithPostBody(body).WithHeader(headerName, header).Response()
+		assert.Nil(err)
+		return res.StatusCode
+	}
+
+	assert.Equal(http.StatusOK, send("/shopify", "X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString(signature)))
+	assert.Equal(http.StatusBadRequest, send("/shopify", "X-Hub-Signature-256", "sha256="+hex.EncodeToString(signature)))
+
+	assert.Equal(http.StatusOK, send("/github", "X-Hub-Signature-256", "sha256="+hex.EncodeToString(signature)))
+	assert.Equal(http.StatusBadRequest, send("/github", "X-Hub-Signature-256", hex.EncodeToString(signature)), "the prefix is required")
+	assert.Equal(http.StatusBadRequest, send("/github", "X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString(signature)))
+}
+
+func TestConfiguredSignatureScheme(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("HMAC_HEADER_NAME", os.Getenv("HMAC_HEADER_NAME"))
+	defer os.Setenv("SIGNATURE_ENCODING", os.Getenv("SIGNATURE_ENCODING"))
+	defer os.Setenv("SIGNATURE_PREFIX", os.Getenv("SIGNATURE_PREFIX"))
+	os.Setenv("HMAC_HEADER_NAME", "")
+	os.Setenv("SIGNATURE_ENCODING", "")
+	os.Setenv("SIGNATURE_PREFIX", "")
+	assert.Equal(shopifySignatureScheme, configuredSignatureScheme())
+
+	os.Setenv("HMAC_HEADER_NAME", "X-Hub-Signature-256")
+	os.Setenv("SIGNATURE_ENCODING", "hex")
+	os.Setenv("SIGNATURE_PREFIX", "sha256=")
+	assert.Equal(signatureScheme{HeaderName: "X-Hub-Signature-256", Encoding: signatureEncodingHex, Prefix: "sha256="}, configuredSignatureScheme())
+}
+
+func TestValidateSignatureEncoding(t *testing.T) {
+	assert := assert.New(t)
+
+	assert.Nil(validateSignatureEncoding("base64"))
+	assert.Nil(validateSignatureEncoding("hex"))
+	assert.NotNil(validateSignatureEncoding("base32"))
+}
+
+func TestIdempotencyKey(t *testing.T) {
+	assert := assert.New(t)
+
+	body := []byte(`{"id":1234}`)
+	key := idempotencyKey("orders/create", body)
+	assert.Len(key, 64)
+	assert.Equal(key, idempotencyKey("orders/create", []byte(`{"id":1234}`)))
+
+	assert.NotEqual(key, idempotencyKey("orders/create", []byte(`{"id":1235}`)))
+	assert.NotEqual(key, idempotencyKey("orders/paid", body))
+	assert.NotEqual(idempotencyKey("ab", []byte("c")), idempotencyKey("a", []byte("bc")))
+}
+
+func TestOrderRouteTrailingSlash(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	order := map[string]interface{}{"id": 1234, "total_price": "12.50"}
+	app := newApp()
+	for _, path := range []string{"/order", "/order/"} {
+		res, err := app.Mock().WithVerb("POST").WithPathf("%s", path).WithPostBodyAsJSON(order).Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode, path)
+	}
+	assert.Len(captured.Requests(), 2)
+}
+
+func TestMatchTrailingSlashDisabled(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("MATCH_TRAILING_SLASH", os.Getenv("MATCH_TRAILING_SLASH"))
+	os.Setenv("MATCH_TRAILING_SLASH", "")
+	assert.True(matchTrailingSlash())
+
+	os.Setenv("MATCH_TRAILING_SLASH", "false")
+	assert.False(matchTrailingSlash())
+	assert.False(newApp().MatchTrailingSlash())
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// metricsContentType is the prometheus text exposition format.
+const metricsContentType = "text/plain; version=0.0.4; charset=utf-8"
+
+var (
+	// requestsReceived counts webhook requests by route.
+	requestsReceived = newCounter("message_bus_requests_total", "Webhook requests received.", "route")
+	// hmacFailures counts webhook requests rejected for a missing or invalid signature, by route.
+	hmacFailures = newCounter("message_bus_hmac_failures_total", "Webhook requests with a missing or invalid signature.", "route")
+	// hmacVerifications counts signature checks by outcome, one of the `verifyOutcome...` constants, so a
+	// spike in mismatches stands out from a misconfigured sender that omits the header.
+	hmacVerifications = newCounter("message_bus_hmac_verifications_total", "Webhook signature checks by outcome.", "outcome")
+	// slackPostSuccesses counts notifications slack accepted, by topic; posts can outlive their request, so they aren't counted by route.
+	slackPostSuccesses = newCounter("message_bus_slack_post_successes_total", "Notifications slack accepted.", "topic")
+	// slackPostFailures counts notifications slack didn't accept after every retry, by topic.
+	slackPostFailures = newCounter("message_bus_slack_post_failures_total", "Notifications slack didn't accept after retrying.", "topic")
+	// teeSuccesses counts webhooks forwarded to the tee sink, by route.
+	teeSuccesses = newCounter("message_bus_tee_successes_total", "Webhooks forwarded to the tee sink.", "route")
+	// teeFailures counts webhooks the tee sink didn't accept after retrying, by route.
+	teeFailures = newCounter("message_bus_tee_failures_total", "Webhooks the tee sink didn't accept after retrying.", "route")
+)
+
+// The outcomes `hmacVerifications` counts; malformed signatures count as mismatches.
+const (
+	verifyOutcomeSuccess       = "verify_success"
+	verifyOutcomeMissingHeader = "verify_missing_header"
+	verifyOutcomeMismatch      = "verify_mismatch"
+)
+
+// metricCounters are the counters `/metrics` exposes, in order.
+var metricCounters = []*counter{requestsReceived, hmacFailures, hmacVerifications, slackPostSuccesses, slackPostFailures, teeSuccesses, teeFailures}
+
+func newCounter(name, help, label string) *counter {
+	return &counter{Name: name, Help: help, Label: label, values: map[string]int64{}}
+}
+
+// counter is a prometheus counter with one label, safe for concurrent use.
+type counter struct {
+	sync.Mutex
+	Name   string
+	Help   string
+	Label  string
+	values map[string]int64
+}
+
+// Inc increments the count for a label value.
+func (c *counter) Inc(labelValue string) {
+	c.Lock()
+	defer c.Unlock()
+	c.values[labelValue]++
+}
+
+// Value returns the count for a label value.
+func (c *counter) Value(labelValue string) int64 {
+	c.Lock()
+	defer c.Unlock()
+	return c.values[labelValue]
+}
+
+// Reset zeroes every count.
+func (c *counter) Reset() {
+	c.Lock()
+	defer c.Unlock()
+	c.values = map[string]int64{}
+}
+
+// WriteTo writes the counter in the prometheus text format, with its label values sorted.
+func (c *counter) WriteTo(w io.Writer) (int64, error) {
+	c.Lock()
+	labelValues := make([]string, 0, len(c.values))
+	for labelValue := range c.values {
+		labelValues = append(labelValues, labelValue)
+	}
+	sort.Strings(labelValues)
+
+	buffer := bytes.NewBuffer(nil)
+	fmt.Fprintf(buffer, "# HELP %s %s\n", c.Name, c.Help)
+	fmt.Fprintf(buffer, "# TYPE %s counter\n", c.Name)
+	for _, labelValue := range labelValues {
+		fmt.Fprintf(buffer, "%s{%s=\"%s\"} %d\n", c.Name, c.Label, escapeLabelValue(labelValue), c.values[labelValue])
+	}
+	c.Unlock()
+
+	return buffer.WriteTo(w)
+}
+
+// labelValueEscaper escapes label values per the prometheus text format.
+var labelValueEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+func escapeLabelValue(value string) string {
+	return labelValueEscaper.Replace(value)
+}
+
+// metricsAction exposes the webhook counters in the prometheus text format.
+func metricsAction(rc *web.RequestContext) web.ControllerResult {
+	buffer := bytes.NewBuffer(nil)
+	for _, c := range metricCounters {
+		c.WriteTo(buffer)
+	}
+	return rc.RawWithContentType(metricsContentType, buffer.Bytes())
+}
@@ -0,0 +1,133 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func resetMetrics() {
+	for _, c := range metricCounters {
+		c.Reset()
+	}
+}
+
+func TestMetricsScrape(t *testing.T) {
+	assert := assert.New(t)
+
+	resetMetrics()
+	defer resetMetrics()
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	for x := 0; x < 2; x++ {
+		res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+			WithHeader("X-Shopify-Topic", "orders/create").WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusOK, res.StatusCode)
+	}
+	res, err := app.Mock().WithVerb("POST").WithPathf("/shopper").WithPostBody(body).
+		WithHeader("X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString([]byte("forged"))).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	captured.StatusCode = http.StatusNotFound
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Topic", "orders/create").WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusInternalServerError, res.StatusCode)
+
+	res, err = app.Mock().WithPathf("/metrics").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(metricsContentType, res.Header.Get("Content-Type"))
+	scraped, err := ioutil.ReadAll(res.Body)
+	assert.Nil(err)
+
+	metrics := string(scraped)
+	assert.Contains("# TYPE message_bus_requests_total counter\n", metrics)
+	assert.Contains("message_bus_requests_total{route=\"/order\"} 3\n", metrics)
+	assert.Contains("message_bus_requests_total{route=\"/shopper\"} 1\n", metrics)
+	assert.Contains("message_bus_hmac_failures_total{route=\"/shopper\"} 1\n", metrics)
+	assert.Contains("message_bus_hmac_verifications_total{outcome=\"verify_mismatch\"} 1\n", metrics)
+	assert.Contains("message_bus_hmac_verifications_total{outcome=\"verify_success\"} 3\n", metrics)
+	assert.Contains("message_bus_slack_post_successes_total{topic=\"orders/create\"} 2\n", metrics)
+	assert.Contains("message_bus_slack_post_failures_total{topic=\"orders/create\"} 1\n", metrics)
+}
+
+func TestHMACVerificationMetrics(t *testing.T) {
+	assert := assert.New(t)
+
+	resetMetrics()
+	defer resetMetrics()
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Topic", "orders/create").WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Equal(int64(1), hmacVerifications.Value(verifyOutcomeSuccess))
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Topic", "orders/create").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+	assert.Equal(int64(1), hmacVerifications.Value(verifyOutcomeMissingHeader))
+
+	for _, forged := range []string{base64.StdEncoding.EncodeToString([]byte("forged")), "not base64!"} {
+		res, err = app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+			WithHeader("X-Shopify-Topic", "orders/create").WithHeader("X-Shopify-Hmac-Sha256", forged).Response()
+		assert.Nil(err)
+		assert.Equal(http.StatusBadRequest, res.StatusCode)
+	}
+	assert.Equal(int64(2), hmacVerifications.Value(verifyOutcomeMismatch), "malformed signatures count as mismatches")
+	assert.Equal(int64(1), hmacVerifications.Value(verifyOutcomeSuccess))
+	assert.Equal(int64(1), hmacVerifications.Value(verifyOutcomeMissingHeader))
+}
+
+func TestCounterWriteTo(t *testing.T) {
+	assert := assert.New(t)
+
+	c := newCounter("test_total", "A test counter.", "route")
+	c.Inc("/b")
+	c.Inc("/a")
+	c.Inc("/a")
+	c.Inc(`say "hi"`)
+	assert.Equal(int64(2), c.Value("/a"))
+
+	buffer := bytes.NewBuffer(nil)
+	_, err := c.WriteTo(buffer)
+	assert.Nil(err)
+	assert.Equal("# HELP test_total A test counter.\n# TYPE test_total counter\n"+
+		"test_total{route=\"/a\"} 2\ntest_total{route=\"/b\"} 1\ntest_total{route=\"say \\\"hi\\\"\"} 1\n", buffer.String())
+}
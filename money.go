@@ -0,0 +1,65 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+
+	"github.com/blendlabs/go-util"
+)
+
+// money is an amount in cents, so prices display exactly as shopify sent them rather than with float
+// rounding artifacts like `19.989999`.
+type money int64
+
+// parseMoney parses a price from a payload value: a decimal string like shopify sends, or a number.
+func parseMoney(value interface{}) (money, error) {
+	switch typed := value.(type) {
+	case string:
+		return parseMoneyString(typed)
+	case json.Number:
+		return parseMoneyString(typed.String())
+	case float64:
+		if math.IsNaN(typed) || math.IsInf(typed, 0) {
+			return 0, fmt.Errorf("invalid price: %v", typed)
+		}
+		return money(math.Round(typed * 100)), nil
+	case int:
+		return money(typed * 100), nil
+	default:
+		return 0, fmt.Errorf("invalid price: %v", value)
+	}
+}
+
+// parseMoneyString parses a price string with `util.ParseMoney`, so currency symbols and thousands
+// separators are accepted.
+func parseMoneyString(value string) (money, error) {
+	cents, err := util.ParseMoney(value)
+	if err != nil {
+		return 0, fmt.Errorf("invalid price: %q", value)
+	}
+	return money(cents), nil
+}
+
+// String formats the amount with two decimal places, like `1000000.00`.
+func (m money) String() string {
+	sign, cents := "", int64(m)
+	if cents < 0 {
+		sign, cents = "-", -cents
+	}
+	return fmt.Sprintf("%s%d.%02d", sign, cents/100, cents%100)
+}
+
+// readMapMoney returns the price at `keys` formatted for display, the raw value if it isn't a valid
+// price, or the empty string if it's missing.
+func readMapMoney(contents map[string]interface{}, keys ...string) string {
+	value := readMap(contents, keys...)
+	if value == nil {
+		return ""
+	}
+	amount, err := parseMoney(value)
+	if err != nil {
+		return readMapString(contents, keys...)
+	}
+	return amount.String()
+}
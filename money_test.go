@@ -0,0 +1,68 @@
+package main
+
+import (
+	"encoding/json"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestParseMoney(t *testing.T) {
+	assert := assert.New(t)
+
+	for raw, expected := range map[string]string{
+		"0.10":        "0.10",
+		"19.99":       "19.99",
+		"1000000.00":  "1000000.00",
+		"12.5":        "12.50",
+		"7":           "7.00",
+		" 3.05 ":      "3.05",
+		"-4.20":       "-4.20",
+		"99999999.99": "99999999.99",
+		"1,000.00":    "1000.00",
+		"$1,234.50":   "1234.50",
+		"+0.5":        "0.50",
+	} {
+		amount, err := parseMoney(raw)
+		assert.Nil(err, raw)
+		assert.Equal(expected, amount.String(), raw)
+	}
+
+	amount, err := parseMoney(19.99)
+	assert.Nil(err)
+	assert.Equal("19.99", amount.String())
+	amount, err = parseMoney(0.1 + 0.2)
+	assert.Nil(err)
+	assert.Equal("0.30", amount.String())
+
+	for _, invalid := range []interface{}{"", "abc", "1.999", "1.", "12 USD", "1,5", nil, true} {
+		_, err := parseMoney(invalid)
+		assert.NotNil(err)
+	}
+}
+
+func TestReadMapMoney(t *testing.T) {
+	assert := assert.New(t)
+
+	var order map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{"total_price":"0.10","subtotal_price":1000000.00,"total_tax":"n/a"}`), &order))
+	assert.Equal("0.10", readMapMoney(order, "total_price"))
+	assert.Equal("1000000.00", readMapMoney(order, "subtotal_price"))
+	assert.Equal("n/a", readMapMoney(order, "total_tax"), "invalid prices display as sent")
+	assert.Empty(readMapMoney(order, "total_discounts"))
+}
+
+func TestOrderTextPrices(t *testing.T) {
+	assert := assert.New(t)
+
+	for raw, expected := range map[string]string{
+		`"0.10"`:       "|Order 450789469 · 0.10 · Guest>",
+		`"1000000.00"`: "|Order 450789469 · 1000000.00 · Guest>",
+		`19.99`:        "|Order 450789469 · 19.99 · Guest>",
+	} {
+		var order map[string]interface{}
+		assert.Nil(json.Unmarshal([]byte(`{"id":450789469,"total_price":`+raw+`}`), &order))
+		assert.Contains(expected, orderText("kissandwear.com", order))
+		assert.Contains(expected, orderCancelText("kissandwear.com", order))
+	}
+}
@@ -0,0 +1,439 @@
+package main
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"regexp"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/blendlabs/go-request"
+	"github.com/blendlabs/go-util"
+)
+
+const (
+	contentTypeJSON = "application/json"
+	contentTypeForm = "application/x-www-form-urlencoded"
+
+	shopifyIconURL = "https://support.wombat.co/hc/en-us/article_attachments/200579685/shopify-expert-web-designer.jpg"
+)
+
+var (
+	_notifier notifier
+
+	// outboundHook, if set, is applied to every outbound notifier request; tests use it to mock responses.
+	outboundHook func(*request.HTTPRequest) *request.HTTPRequest
+)
+
+// notification is a formatted message along with the webhook payload it was built from.
+type notification struct {
+	Topic    string
+	Text     string
+	Username string
+	IconURL  string
+	Payload  map[string]interface{}
+	// Severity is the severity a `severityNotifier` routed the notification by, if one did.
+	Severity string
+}
+
+// fields returns the slack-style fields for the notification.
+func (n *notification) fields() map[string]interface{} {
+	return map[string]interface{}{
+		"text":     n.Text,
+		"username": n.Username,
+		"icon_url": n.IconURL,
+	}
+}
+
+// blocks returns the notification as slack block kit blocks.
+func (n *notification) blocks() []map[string]interface{} {
+	blocks := []map[string]interface{}{
+		{
+			"type": "section",
+			"text": map[string]interface{}{"type": "mrkdwn", "text": n.Text},
+		},
+	}
+	if len(n.Topic) != 0 {
+		blocks = append(blocks,
+			map[string]interface{}{"type": "divider"},
+			map[string]interface{}{
+				"type":     "context",
+				"elements": []map[string]interface{}{{"type": "mrkdwn", "text": n.Topic}},
+			},
+		)
+	}
+	return blocks
+}
+
+// render returns the notification with its text replaced by `tmpl` rendered with it, so each
+// notifier can format the same payload its own way. A nil template leaves the notification as is.
+func (n *notification) render(tmpl *template.Template) (*notification, error) {
+	if tmpl == nil {
+		return n, nil
+	}
+	buffer := bytes.NewBuffer(nil)
+	if err := tmpl.Execute(buffer, n); err != nil {
+		return nil, err
+	}
+	rendered := *n
+	rendered.Text = buffer.String()
+	return &rendered, nil
+}
+
+// parseMessageTemplate parses the text/template in the environment variable `name`, if set.
+func parseMessageTemplate(name string) (*template.Template, error) {
+	contents := os.Getenv(name)
+	if len(contents) == 0 {
+		return nil, nil
+	}
+	tmpl, err := template.New(strings.ToLower(name)).Parse(contents)
+	if err != nil {
+		return nil, fmt.Errorf("invalid `%s`: %v", name, err)
+	}
+	return tmpl, nil
+}
+
+// notifier delivers notifications to a downstream service.
+type notifier interface {
+	Notify(n *notification) error
+}
+
+// activeNotifier returns the notifier selected by `NOTIFIER` and `NOTIFIER_FALLBACKS`, defaulting to slack.
+func activeNotifier() notifier {
+	if _notifier == nil {
+		_notifier, _ = newConfiguredNotifier()
+		if _notifier == nil {
+			_notifier = &slackNotifier{}
+		}
+	}
+	return _notifier
+}
+
+// newNotifier returns a notifier by name, reading its settings from the environment. A comma
+// separated list of names, like `slack,discord`, returns a notifier that delivers to each.
+func newNotifier(name string) (notifier, error) {
+	if names := strings.Split(name, ","); len(names) > 1 {
+		var notifiers multiNotifier
+		for _, name := range names {
+			n, err := newNotifier(strings.TrimSpace(name))
+			if err != nil {
+				return nil, err
+			}
+			notifiers = append(notifiers, n)
+		}
+		return notifiers, nil
+	}
+
+	switch strings.ToLower(name) {
+	case "", "slack":
+		sn, err := newSlackNotifier()
+		if err != nil {
+			return nil, err
+		}
+		return sn, nil
+	case "discord":
+		dn, err := newDiscordNotifier(os.Getenv("DISCORD_WEBHOOK"))
+		if err != nil {
+			return nil, err
+		}
+		return dn, nil
+	case "stdout":
+		return &stdoutNotifier{Writer: os.Stdout}, nil
+	case "pagerduty":
+		pn, err := newPagerDutyNotifier(os.Getenv("PAGERDUTY_ROUTING_KEY"), os.Getenv("PAGERDUTY_SEVERITIES"))
+		if err != nil {
+			return nil, err
+		}
+		return pn, nil
+	case "webhook":
+		wn, err := newWebhookNotifier(
+			os.Getenv("NOTIFIER_URL"),
+			os.Getenv("NOTIFIER_METHOD"),
+			os.Getenv("NOTIFIER_CONTENT_TYPE"),
+			os.Getenv("NOTIFIER_BODY_TEMPLATE"),
+		)
+		if err != nil {
+			return nil, err
+		}
+		return wn, nil
+	}
+	return nil, fmt.Errorf("unknown `NOTIFIER`: %s", name)
+}
+
+// outboundUserAgent identifies the message bus in the logs of the services it calls.
+const outboundUserAgent = "go-message-bus"
+
+// outboundRequest returns a new request for a notifier to send.
+func outboundRequest(client *request.Client) *request.HTTPRequest {
+	req := request.NewHTTPRequest()
+	if client != nil {
+		req = client.NewRequest()
+	}
+	req = req.WithUserAgent(outboundUserAgent)
+	if outboundHook != nil {
+		req = outboundHook(req)
+	}
+	return req
+}
+
+// multiNotifier delivers notifications to several notifiers. Every notifier is tried, each retried on
+// its own per `deliveryRetryPolicy()`, so a failing notifier doesn't resend to the ones that succeeded.
+type multiNotifier []notifier
+
+// Notify implements notifier. Every notifier has already been retried, so its error is permanent, and
+// is a `*multiNotifierError` naming the notifiers that failed.
+func (mn multiNotifier) Notify(n *notification) error {
+	failed := &multiNotifierError{Notification: n, Total: len(mn)}
+	for _, notifier := range mn {
+		err := deliveryRetryPolicy().Do(func() error {
+			return notifier.Notify(n)
+		})
+		if err != nil {
+			failed.Notifiers = append(failed.Notifiers, notifier)
+			failed.Errors = append(failed.Errors, err)
+		}
+	}
+	if len(failed.Notifiers) != 0 {
+		return permanent(failed)
+	}
+	return nil
+}
+
+// multiNotifierError is the failure of some of a multiNotifier's notifiers, so just those can be
+// dead-lettered and redelivered.
+type multiNotifierError struct {
+	Notification *notification
+	Total        int
+	Notifiers    []notifier
+	Errors       []error
+}
+
+// Error implements error.
+func (mne *multiNotifierError) Error() string {
+	failures := make([]string, len(mne.Errors))
+	for index, err := range mne.Errors {
+		failures[index] = err.Error()
+	}
+	return fmt.Sprintf("%d of %d notifiers failed: %s", len(mne.Errors), mne.Total, strings.Join(failures, "; "))
+}
+
+// newSlackNotifier returns a slack notifier, sending block kit messages if `SLACK_FORMAT` is `blocks`
+// and formatting messages with `SLACK_TEMPLATE` if it's set.
+func newSlackNotifier() (*slackNotifier, error) {
+	tmpl, err := parseMessageTemplate("SLACK_TEMPLATE")
+	if err != nil {
+		return nil, err
+	}
+	return &slackNotifier{
+		Blocks:   strings.ToLower(os.Getenv("SLACK_FORMAT")) == "blocks",
+		Template: tmpl,
+	}, nil
+}
+
+// slackNotifier posts notifications to a slack incoming webhook.
+type slackNotifier struct {
+	// URL is the incoming webhook url, defaulting to the webhook for the notification's topic.
+	URL string
+	// Blocks sends the message as block kit `blocks`; `text` is still sent as the
+	// fallback for clients and webhooks that don't support blocks.
+	Blocks bool
+	// Template, if set, renders the message text from the notification.
+	Template *template.Template
+}
+
+func (sn *slackNotifier) url(topic string) string {
+	if len(sn.URL) != 0 {
+		return sn.URL
+	}
+	return slackWebhookFor(topic)
+}
+
+// Notify implements notifier.
+func (sn *slackNotifier) Notify(n *notification) error {
+	n, err := n.render(sn.Template)
+	if err != nil {
+		return err
+	}
+	if err = postToSlackWithRetry(sn.url(n.Topic), sn.body(n)); err != nil {
+		slackPostFailures.Inc(n.Topic)
+		return err
+	}
+	slackPostSuccesses.Inc(n.Topic)
+	return nil
+}
+
+// postToSlackWithRetry posts a message to a slack webhook, retrying rate limits (429s), server errors
+// and network errors under the delivery retry policy (see `RETRY_ATTEMPTS` and `RETRY_BASE_DELAY`),
+// and waiting at least as long as slack's `Retry-After` asks. Any other rejection fails immediately,
+// as does a retry the slack client's retry budget doesn't allow.
+// The error returned is already retried, so it's marked permanent for the caller's own policy.
+func postToSlackWithRetry(url string, body map[string]interface{}) error {
+	policy := *deliveryRetryPolicy()
+	policy.Allow = slackClient().AllowRetry
+	return permanent(policy.Do(func() error {
+		responseBody, meta, err := outboundRequest(slackClient()).AsPost().WithURL(url).WithJSONBody(body).FetchStringWithMeta()
+		if err != nil {
+			return err
+		}
+		err = checkSlackResponse(meta.StatusCode, responseBody)
+		if err == nil {
+			return nil
+		}
+		if meta.StatusCode == http.StatusTooManyRequests || meta.StatusCode >= http.StatusInternalServerError {
+			return retryAfter(err, parseRetryAfter(meta.Headers.Get("Retry-After"), time.Now()))
+		}
+		return permanent(err)
+	}))
+}
+
+// checkSlackResponse returns an error unless slack accepted a message. Incoming webhooks respond
+// with the literal `ok` on success, and an error string otherwise, sometimes with a 200.
+func checkSlackResponse(statusCode int, body string) error {
+	body = strings.TrimSpace(body)
+	if statusCode < 200 || statusCode > 299 {
+		return fmt.Errorf("slack responded with %d: %s", statusCode, body)
+	}
+	if body != "ok" {
+		return fmt.Errorf("slack did not accept the message: %s", body)
+	}
+	return nil
+}
+
+func (sn *slackNotifier) body(n *notification) map[string]interface{} {
+	body := n.fields()
+	if sn.Blocks {
+		body["blocks"] = n.blocks()
+	}
+	return body
+}
+
+// slackLink matches slack's `<url|label>` links.
+var slackLink = regexp.MustCompile(`<([^<>|]+)\|([^<>]+)>`)
+
+// newDiscordNotifier returns a discord notifier for the given webhook url, formatting messages
+// with `DISCORD_TEMPLATE` if it's set.
+func newDiscordNotifier(url string) (*discordNotifier, error) {
+	if len(url) == 0 {
+		return nil, fmt.Errorf("`DISCORD_WEBHOOK` is required for the discord notifier")
+	}
+	tmpl, err := parseMessageTemplate("DISCORD_TEMPLATE")
+	if err != nil {
+		return nil, err
+	}
+	return &discordNotifier{URL: url, Template: tmpl}, nil
+}
+
+// discordNotifier posts notifications to a discord webhook.
+type discordNotifier struct {
+	URL string
+	// Template, if set, renders the message content from the notification. Without one, the
+	// slack formatted text is sent with its links rewritten as markdown.
+	Template *template.Template
+}
+
+// Notify implements notifier.
+func (dn *discordNotifier) Notify(n *notification) error {
+	content := slackLink.ReplaceAllString(n.Text, "[$2]($1)")
+	if dn.Template != nil {
+		rendered, err := n.render(dn.Template)
+		if err != nil {
+			return err
+		}
+		content = rendered.Text
+	}
+
+	return executeDelivery("discord", outboundRequest(nil).AsPost().WithURL(dn.URL).WithJSONBody(map[string]interface{}{
+		"content":    content,
+		"username":   n.Username,
+		"avatar_url": n.IconURL,
+	}))
+}
+
+// executeDelivery makes a delivery request to `target`, failing unless it responds with a 2xx. Rate
+// limits (429s) and server errors are retryable, no sooner than a `Retry-After` asks; any other
+// rejection is permanent.
+func executeDelivery(target string, req *request.HTTPRequest) error {
+	meta, err := req.ExecuteWithMeta()
+	if err != nil {
+		return err
+	}
+	if meta.StatusCode >= http.StatusOK && meta.StatusCode < http.StatusMultipleChoices {
+		return nil
+	}
+	err = fmt.Errorf("%s responded with %d", target, meta.StatusCode)
+	if meta.StatusCode == http.StatusTooManyRequests || meta.StatusCode >= http.StatusInternalServerError {
+		return retryAfter(err, parseRetryAfter(meta.Headers.Get("Retry-After"), time.Now()))
+	}
+	return permanent(err)
+}
+
+// stdoutNotifier writes notifications to a writer, for local development and demos without a downstream service.
+type stdoutNotifier struct {
+	Writer io.Writer
+}
+
+// Notify implements notifier.
+func (sn *stdoutNotifier) Notify(n *notification) error {
+	if len(n.Topic) != 0 {
+		_, err := fmt.Fprintf(sn.Writer, "[%s] %s\n", n.Topic, n.Text)
+		return err
+	}
+	_, err := fmt.Fprintln(sn.Writer, n.Text)
+	return err
+}
+
+// newWebhookNotifier returns a notifier for generic (slack-like) webhook targets. The method
+// defaults to `POST` and the content type to json; the body template, if set, is a text/template
+// rendered with the notification.
+func newWebhookNotifier(url, method, contentType, bodyTemplate string) (*webhookNotifier, error) {
+	if len(url) == 0 {
+		return nil, fmt.Errorf("`NOTIFIER_URL` is required for the webhook notifier")
+	}
+
+	wn := &webhookNotifier{
+		URL:         url,
+		Method:      strings.ToUpper(util.EmptyCoalesce(method, "POST")),
+		ContentType: util.EmptyCoalesce(contentType, contentTypeJSON),
+	}
+	if len(bodyTemplate) != 0 {
+		tmpl, err := template.New("body").Parse(bodyTemplate)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `NOTIFIER_BODY_TEMPLATE`: %v", err)
+		}
+		wn.BodyTemplate = tmpl
+	}
+	return wn, nil
+}
+
+// webhookNotifier sends notifications to a webhook with a configurable method, content type and body.
+type webhookNotifier struct {
+	URL          string
+	Method       string
+	ContentType  string
+	BodyTemplate *template.Template
+}
+
+// Notify implements notifier.
+func (wn *webhookNotifier) Notify(n *notification) error {
+	req := outboundRequest(nil).WithVerb(wn.Method).WithURL(wn.URL)
+
+	if wn.BodyTemplate != nil {
+		buffer := bytes.NewBuffer(nil)
+		if err := wn.BodyTemplate.Execute(buffer, n); err != nil {
+			return err
+		}
+		return executeDelivery("webhook", req.WithRawBody(buffer.Bytes()).WithContentType(wn.ContentType))
+	}
+
+	if wn.ContentType == contentTypeForm {
+		for key, value := range n.fields() {
+			req = req.WithPostData(key, fmt.Sprintf("%v", value))
+		}
+		return executeDelivery("webhook", req)
+	}
+	return executeDelivery("webhook", req.WithJSONBody(n.fields()).WithContentType(wn.ContentType))
+}
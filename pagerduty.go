@@ -0,0 +1,129 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+	"unicode/utf8"
+)
+
+const (
+	// pagerDutyEventsURL is the pagerduty events api v2 endpoint.
+	pagerDutyEventsURL = "https://events.pagerduty.com/v2/enqueue"
+	// pagerDutySummaryLength is the longest summary pagerduty accepts.
+	pagerDutySummaryLength = 1024
+	// pagerDutySource identifies the bus as the source of its events.
+	pagerDutySource = "go-message-bus"
+)
+
+// pagerDutySeverities are the severities the events api accepts.
+var pagerDutySeverities = []string{"critical", "error", "warning", "info"}
+
+// newPagerDutyNotifier returns a notifier triggering pagerduty events with the given routing key, for
+// the topics in `severities`, formatted like `orders/cancelled=critical,refunds/create=warning`.
+// Every topic is paged as `error` if it's empty.
+func newPagerDutyNotifier(routingKey, severities string) (*pagerDutyNotifier, error) {
+	if len(routingKey) == 0 {
+		return nil, fmt.Errorf("`PAGERDUTY_ROUTING_KEY` is required for the pagerduty notifier")
+	}
+
+	pn := &pagerDutyNotifier{URL: pagerDutyEventsURL, RoutingKey: routingKey}
+	for _, pair := range strings.Split(severities, ",") {
+		if len(strings.TrimSpace(pair)) == 0 {
+			continue
+		}
+		parts := strings.SplitN(pair, "=", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("invalid `PAGERDUTY_SEVERITIES`: %s, must be `topic=severity`", pair)
+		}
+		topic, severity := strings.ToLower(strings.TrimSpace(parts[0])), strings.ToLower(strings.TrimSpace(parts[1]))
+		if !isPagerDutySeverity(severity) {
+			return nil, fmt.Errorf("invalid `PAGERDUTY_SEVERITIES`: %s, must be one of %s", severity, strings.Join(pagerDutySeverities, ", "))
+		}
+		if pn.Severities == nil {
+			pn.Severities = map[string]string{}
+		}
+		pn.Severities[topic] = severity
+	}
+	return pn, nil
+}
+
+func isPagerDutySeverity(severity string) bool {
+	for _, valid := range pagerDutySeverities {
+		if severity == valid {
+			return true
+		}
+	}
+	return false
+}
+
+// pagerDutyNotifier triggers pagerduty events for notifications, for paging on critical topics.
+type pagerDutyNotifier struct {
+	URL        string
+	RoutingKey string
+	// Severities maps the topics paged to their severity; every topic is paged as `error` if it's nil.
+	Severities map[string]string
+}
+
+// Notify implements notifier. Notifications for topics that aren't paged are ignored.
+func (pn *pagerDutyNotifier) Notify(n *notification) error {
+	severity, isPaged := pn.severity(n)
+	if !isPaged {
+		return nil
+	}
+	return outboundRequest(nil).AsPost().WithURL(pn.URL).WithJSONBody(pn.event(n, severity)).
+		WithExpectedStatus(http.StatusAccepted).Execute()
+}
+
+// severity returns the severity a notification is paged with, and if it's paged at all. Notifications
+// routed by severity are paged with the severity they were routed by, whatever `Severities` says.
+func (pn *pagerDutyNotifier) severity(n *notification) (string, bool) {
+	if isPagerDutySeverity(n.Severity) {
+		return n.Severity, true
+	}
+	if pn.Severities == nil {
+		return "error", true
+	}
+	severity, isPaged := pn.Severities[strings.ToLower(n.Topic)]
+	return severity, isPaged
+}
+
+// event returns the events api v2 trigger for a notification.
+func (pn *pagerDutyNotifier) event(n *notification, severity string) map[string]interface{} {
+	return map[string]interface{}{
+		"routing_key":  pn.RoutingKey,
+		"event_action": "trigger",
+		"dedup_key":    pagerDutyDedupKey(n),
+		"client":       pagerDutySource,
+		"payload": map[string]interface{}{
+			"summary":   pagerDutySummary(n.Text),
+			"source":    pagerDutySource,
+			"severity":  severity,
+			"component": n.Topic,
+			"custom_details": map[string]interface{}{
+				"text":  n.Text,
+				"topic": n.Topic,
+			},
+		},
+	}
+}
+
+// pagerDutyDedupKey returns a stable key for a notification, so retries and redeliveries of it update
+// the incident it opened rather than opening another.
+func pagerDutyDedupKey(n *notification) string {
+	return idempotencyKey(n.Topic, []byte(n.Text))
+}
+
+// pagerDutySummary returns the message on one line with its slack links reduced to their labels,
+// cut to the length pagerduty accepts.
+func pagerDutySummary(text string) string {
+	summary := strings.Join(strings.Fields(slackLink.ReplaceAllString(text, "$2")), " ")
+	if len(summary) <= pagerDutySummaryLength {
+		return summary
+	}
+	cut := pagerDutySummaryLength - len("…")
+	for cut > 0 && !utf8.RuneStart(summary[cut]) {
+		cut--
+	}
+	return summary[:cut] + "…"
+}
@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestPagerDutyNotifierPayload(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusAccepted, `{"status":"success","message":"Event processed"}`)
+	defer captured.Restore()
+
+	pn, err := newPagerDutyNotifier("R0UT1NGK3Y", "orders/cancelled=critical, refunds/create=warning")
+	assert.Nil(err)
+	assert.Nil(pn.Notify(&notification{
+		Topic: "orders/cancelled",
+		Text: `:x: Order Cancelled!
+                <https://kissandwear.com/admin/orders/450789469|12.50> (reason: fraud)`,
+	}))
+
+	assert.Len(captured.Requests(), 1)
+	assert.Equal("POST", captured.Requests()[0].Verb)
+	assert.Equal(pagerDutyEventsURL, captured.Requests()[0].URL)
+
+	var event map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &event))
+	assert.Equal("R0UT1NGK3Y", event["routing_key"])
+	assert.Equal("trigger", event["event_action"])
+	assert.Len(event["dedup_key"], 64)
+	payload := event["payload"].(map[string]interface{})
+	assert.Equal(":x: Order Cancelled! 12.50 (reason: fraud)", payload["summary"])
+	assert.Equal("critical", payload["severity"])
+	assert.Equal("go-message-bus", payload["source"])
+	assert.Equal("orders/cancelled", payload["component"])
+	details := payload["custom_details"].(map[string]interface{})
+	assert.Contains("admin/orders/450789469", details["text"].(string))
+}
+
+func TestPagerDutyNotifierSnapshot(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusAccepted, `{"status":"success","message":"Event processed"}`)
+	defer captured.Restore()
+
+	pn, err := newPagerDutyNotifier("R0UT1NGK3Y", "")
+	assert.Nil(err)
+	assert.Nil(pn.Notify(&notification{Topic: "orders/create", Text: "New Sale! <https://kissandwear.com/admin/orders/1|12.50>"}))
+	assert.Len(captured.Requests(), 1)
+
+	assert.JSONEqIgnoring(`{
+		"routing_key": "redacted",
+		"event_action": "trigger",
+		"client": "go-message-bus",
+		"payload": {
+			"summary": "New Sale! 12.50",
+			"source": "go-message-bus",
+			"severity": "error",
+			"component": "orders/create"
+		}
+	}`, string(captured.Requests()[0].Body), []string{"routing_key", "dedup_key", "payload.custom_details"})
+}
+
+func TestPagerDutyDedupKey(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusAccepted, "{}")
+	defer captured.Restore()
+
+	pn, err := newPagerDutyNotifier("R0UT1NGK3Y", "")
+	assert.Nil(err)
+	for _, text := range []string{"Order Cancelled! #1001", "Order Cancelled! #1001", "Order Cancelled! #1002"} {
+		assert.Nil(pn.Notify(&notification{Topic: "orders/cancelled", Text: text}))
+	}
+
+	var keys []string
+	for _, req := range captured.Requests() {
+		var event map[string]interface{}
+		assert.Nil(json.Unmarshal(req.Body, &event))
+		keys = append(keys, event["dedup_key"].(string))
+	}
+	assert.Len(keys, 3)
+	assert.Equal(keys[0], keys[1], "the same notification sent again updates the same incident")
+	assert.NotEqual(keys[0], keys[2])
+	assert.NotEqual(pagerDutyDedupKey(&notification{Topic: "orders/create", Text: "Order Cancelled! #1001"}), keys[0])
+}
+
+func TestPagerDutyNotifierRoutedSeverity(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 3}
+	captured := recordOutbound(http.StatusAccepted, "{}")
+	defer captured.Restore()
+
+	pn, err := newPagerDutyNotifier("R0UT1NGK3Y", "refunds/create=warning")
+	assert.Nil(err)
+	slack := &countingNotifier{Err: fmt.Errorf("slack is down")}
+	sn := &severityNotifier{
+		Topics:   map[string]severity{"orders/cancelled": severityCritical},
+		Routes:   map[severity]notifier{severityCritical: multiNotifier{pn, slack}},
+		Fallback: &countingNotifier{},
+	}
+
+	n := &notification{Topic: "orders/cancelled", Text: "Order Cancelled! #1001"}
+	err = (&retryPolicy{Attempts: 3}).Do(func() error {
+		return sn.Notify(n)
+	})
+	assert.NotNil(err)
+	assert.Contains("slack is down", err.Error())
+	assert.Equal(3, slack.Calls)
+	assert.Len(captured.Requests(), 1, "pagerduty isn't paged again when only slack failed")
+	assert.Empty(n.Severity, "the shared notification is untouched")
+
+	var event map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &event))
+	assert.Equal("critical", event["payload"].(map[string]interface{})["severity"], "the routed severity is paged, though the topic isn't in PAGERDUTY_SEVERITIES")
+}
+
+func TestPagerDutyNotifierTopics(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusAccepted, "{}")
+	defer captured.Restore()
+
+	pn, err := newPagerDutyNotifier("R0UT1NGK3Y", "refunds/create=warning")
+	assert.Nil(err)
+	assert.Nil(pn.Notify(&notification{Topic: "customers/create", Text: "New Shopper Signup!"}))
+	assert.Empty(captured.Requests(), "topics without a severity aren't paged")
+
+	pn, err = newPagerDutyNotifier("R0UT1NGK3Y", "")
+	assert.Nil(err)
+	assert.Nil(pn.Notify(&notification{Topic: "customers/create", Text: "New Shopper Signup!"}))
+	assert.Len(captured.Requests(), 1)
+	var event map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &event))
+	assert.Equal("error", event["payload"].(map[string]interface{})["severity"])
+
+	captured.StatusCode = http.StatusBadRequest
+	captured.Body = `{"status":"invalid event","errors":["'routing_key' is invalid"]}`
+	err = pn.Notify(&notification{Topic: "customers/create", Text: "New Shopper Signup!"})
+	assert.NotNil(err)
+	assert.Contains("routing_key", err.Error())
+}
+
+func TestNewPagerDutyNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	_, err := newPagerDutyNotifier("", "")
+	assert.NotNil(err)
+	_, err = newPagerDutyNotifier("R0UT1NGK3Y", "orders/cancelled=urgent")
+	assert.NotNil(err)
+	_, err = newPagerDutyNotifier("R0UT1NGK3Y", "orders/cancelled")
+	assert.NotNil(err)
+
+	defer os.Setenv("PAGERDUTY_ROUTING_KEY", os.Getenv("PAGERDUTY_ROUTING_KEY"))
+	defer os.Setenv("PAGERDUTY_SEVERITIES", os.Getenv("PAGERDUTY_SEVERITIES"))
+	os.Setenv("PAGERDUTY_ROUTING_KEY", "R0UT1NGK3Y")
+	os.Setenv("PAGERDUTY_SEVERITIES", "Orders/Cancelled=Critical")
+	n, err := newNotifier("pagerduty")
+	assert.Nil(err)
+	assert.Equal(map[string]string{"orders/cancelled": "critical"}, n.(*pagerDutyNotifier).Severities)
+}
+
+func TestPagerDutySummary(t *testing.T) {
+	assert := assert.New(t)
+
+	summary := pagerDutySummary(strings.Repeat("é", pagerDutySummaryLength))
+	assert.True(len(summary) <= pagerDutySummaryLength)
+	assert.True(strings.HasSuffix(summary, "…"))
+	assert.Equal("short", pagerDutySummary("  short \n"))
+}
@@ -0,0 +1,151 @@
+package main
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/blendlabs/go-util"
+)
+
+// redacted replaces payload values that aren't allowlisted.
+const redacted = "[redacted]"
+
+const (
+	defaultPayloadMaxBytes  = 2 << 20
+	defaultPayloadMaxDepth  = 32
+	defaultPayloadMaxTokens = 100000
+)
+
+// payloadLimits bound the webhook bodies we decode, so deeply nested or huge json can't exhaust
+// memory or cpu. A limit less than 1 is not enforced.
+type payloadLimits struct {
+	MaxBytes  int
+	MaxDepth  int
+	MaxTokens int
+}
+
+// payloadDecodeLimits returns the limits from `PAYLOAD_MAX_BYTES`, `PAYLOAD_MAX_DEPTH` (the most
+// nested objects and arrays) and `PAYLOAD_MAX_TOKENS` (the most keys, values and delimiters).
+func payloadDecodeLimits() payloadLimits {
+	return payloadLimits{
+		MaxBytes:  envInt("PAYLOAD_MAX_BYTES", defaultPayloadMaxBytes),
+		MaxDepth:  envInt("PAYLOAD_MAX_DEPTH", defaultPayloadMaxDepth),
+		MaxTokens: envInt("PAYLOAD_MAX_TOKENS", defaultPayloadMaxTokens),
+	}
+}
+
+// decodePayload decodes a json object, first streaming its tokens to reject it if it exceeds the limits.
+func decodePayload(body []byte, limits payloadLimits) (map[string]interface{}, error) {
+	if limits.MaxBytes > 0 && len(body) > limits.MaxBytes {
+		return nil, fmt.Errorf("payload is %d bytes, more than the limit of %d", len(body), limits.MaxBytes)
+	}
+
+	decoder := json.NewDecoder(bytes.NewReader(body))
+	var depth, tokens int
+	for {
+		token, err := decoder.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		tokens++
+		if limits.MaxTokens > 0 && tokens > limits.MaxTokens {
+			return nil, fmt.Errorf("payload has more than the limit of %d tokens", limits.MaxTokens)
+		}
+		if delim, isDelim := token.(json.Delim); isDelim {
+			switch delim {
+			case '{', '[':
+				depth++
+				if limits.MaxDepth > 0 && depth > limits.MaxDepth {
+					return nil, fmt.Errorf("payload is nested deeper than the limit of %d", limits.MaxDepth)
+				}
+			case '}', ']':
+				depth--
+			}
+		}
+	}
+
+	var parsed map[string]interface{}
+	if err := json.Unmarshal(body, &parsed); err != nil {
+		return nil, err
+	}
+	return parsed, nil
+}
+
+// payloadAllowlist returns the payload fields, as dotted paths like `customer.email`, that may appear
+// in messages from `PAYLOAD_ALLOWLIST`, separated by commas or newlines. An empty allowlist allows everything.
+func payloadAllowlist() []string {
+	return util.ParseList(os.Getenv("PAYLOAD_ALLOWLIST"))
+}
+
+// applyPayloadAllowlist returns a copy of the payload with every value not covered by the allowlist
+// masked. Allowing a field allows everything nested under it.
+func applyPayloadAllowlist(payload map[string]interface{}, allowlist []string) map[string]interface{} {
+	if len(allowlist) == 0 {
+		return payload
+	}
+	return maskPayload(payload, "", allowlist)
+}
+
+// allowedPayload returns the payload as messages may echo it, masked by `PAYLOAD_ALLOWLIST`. Handlers
+// compute from the full payload, like totals and variant changes, and mask only what they send.
+func allowedPayload(payload map[string]interface{}) map[string]interface{} {
+	return applyPayloadAllowlist(payload, payloadAllowlist())
+}
+
+func maskPayload(payload map[string]interface{}, prefix string, allowlist []string) map[string]interface{} {
+	masked := make(map[string]interface{}, len(payload))
+	for key, value := range payload {
+		masked[key] = maskValue(value, prefix+key, allowlist)
+	}
+	return masked
+}
+
+// maskValue masks a value at a path. The elements of arrays share the array's path, so `line_items.title`
+// allows the title of every line item.
+func maskValue(value interface{}, path string, allowlist []string) interface{} {
+	if value == nil || isAllowed(path, allowlist) {
+		return value
+	}
+	if !hasAllowedChild(path, allowlist) {
+		return redacted
+	}
+	switch typed := value.(type) {
+	case map[string]interface{}:
+		return maskPayload(typed, path+".", allowlist)
+	case []interface{}:
+		masked := make([]interface{}, len(typed))
+		for index, element := range typed {
+			masked[index] = maskValue(element, path, allowlist)
+		}
+		return masked
+	}
+	return redacted
+}
+
+// isAllowed returns if the path or one of its parents is allowlisted.
+func isAllowed(path string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		if path == allowed || strings.HasPrefix(path, allowed+".") {
+			return true
+		}
+	}
+	return false
+}
+
+// hasAllowedChild returns if a field nested under the path is allowlisted.
+func hasAllowedChild(path string, allowlist []string) bool {
+	for _, allowed := range allowlist {
+		if strings.HasPrefix(allowed, path+".") {
+			return true
+		}
+	}
+	return false
+}
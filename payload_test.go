@@ -0,0 +1,200 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestApplyPayloadAllowlist(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{
+		"id":          1234,
+		"total_price": "12.50",
+		"phone":       "555-555-5555",
+		"customer": map[string]interface{}{
+			"id":    5678,
+			"email": "shopper@example.com",
+			"phone": "555-555-5555",
+		},
+		"note": nil,
+	}
+
+	masked := applyPayloadAllowlist(order, []string{"id", "total_price", "customer.id"})
+	assert.Equal(1234, masked["id"])
+	assert.Equal("12.50", masked["total_price"])
+	assert.Equal(redacted, masked["phone"])
+	assert.Nil(masked["note"])
+	assert.Equal(5678, readMap(masked, "customer", "id"))
+	assert.Equal(redacted, readMap(masked, "customer", "email"))
+	assert.Equal(redacted, readMap(masked, "customer", "phone"))
+
+	// the original payload is untouched
+	assert.Equal("shopper@example.com", readMap(order, "customer", "email"))
+}
+
+func TestApplyPayloadAllowlistParent(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{
+		"email": "shopper@example.com",
+		"customer": map[string]interface{}{
+			"email": "shopper@example.com",
+		},
+	}
+
+	masked := applyPayloadAllowlist(order, []string{"customer"})
+	assert.Equal(redacted, masked["email"])
+	assert.Equal("shopper@example.com", readMap(masked, "customer", "email"))
+}
+
+func TestApplyPayloadAllowlistArrays(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{
+		"line_items": []interface{}{
+			map[string]interface{}{"title": "Sticker", "vendor": "Acme"},
+			map[string]interface{}{"title": "IPod Nano", "vendor": "Apple"},
+			"loose",
+			nil,
+		},
+		"tags": []interface{}{"vip", "wholesale"},
+	}
+
+	masked := applyPayloadAllowlist(order, []string{"line_items.title"})
+	assert.Equal("Sticker", readMap(masked, "line_items", "0", "title"))
+	assert.Equal("IPod Nano", readMap(masked, "line_items", "1", "title"))
+	assert.Equal(redacted, readMap(masked, "line_items", "0", "vendor"))
+	assert.Equal(redacted, readMap(masked, "line_items", "2"))
+	assert.Nil(readMap(masked, "line_items", "3"))
+	assert.Equal(redacted, masked["tags"], "arrays without allowed children are masked whole")
+	assert.Equal("Acme", readMap(order, "line_items", "0", "vendor"), "the original payload is untouched")
+}
+
+func TestApplyPayloadAllowlistUnset(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{"email": "shopper@example.com"}
+	assert.Equal(order, applyPayloadAllowlist(order, nil))
+}
+
+func TestOrderTextAllowlist(t *testing.T) {
+	assert := assert.New(t)
+
+	order := map[string]interface{}{
+		"id":          1234,
+		"total_price": "12.50",
+		"customer": map[string]interface{}{
+			"id":    5678,
+			"email": "shopper@example.com",
+		},
+	}
+
+	actual := orderText("kissandwear.com", applyPayloadAllowlist(order, []string{"id", "total_price", "customer.id"}))
+	assert.False(strings.Contains(actual, "shopper@example.com"))
+	assert.Contains("12.50", actual)
+}
+
+func TestAllowlistOnlyMasksWhatIsSent(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Setenv("PAYLOAD_ALLOWLIST", os.Getenv("PAYLOAD_ALLOWLIST"))
+	os.Setenv("PAYLOAD_ALLOWLIST", "id,total_price")
+
+	order := map[string]interface{}{
+		"id":               1234,
+		"total_price":      "12.50",
+		"financial_status": "paid",
+		"line_items":       []interface{}{map[string]interface{}{"quantity": 2}, map[string]interface{}{"quantity": 1}},
+		"customer":         map[string]interface{}{"email": "shopper@example.com"},
+	}
+	actual := orderText("kissandwear.com", order)
+	assert.Contains("Order 1234 · 12.50 · 3 items", actual, "items are counted from the full payload")
+	assert.Contains(defaultFinancialStatusEmoji["paid"], actual)
+	assert.False(strings.Contains(actual, "shopper@example.com"))
+
+	refund := map[string]interface{}{
+		"order_id":     450789469,
+		"transactions": []interface{}{map[string]interface{}{"kind": "refund", "amount": "49.10"}},
+	}
+	assert.Contains("49.10 refunded on", refundText("kissandwear.com", refund), "the amount is of the full payload")
+}
+
+func TestPayloadAllowlistList(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Setenv("PAYLOAD_ALLOWLIST", os.Getenv("PAYLOAD_ALLOWLIST"))
+
+	os.Setenv("PAYLOAD_ALLOWLIST", " id, total_price\n customer.id ,\n\n,line_items\r\n")
+	assert.Equal([]string{"id", "total_price", "customer.id", "line_items"}, payloadAllowlist())
+
+	os.Setenv("PAYLOAD_ALLOWLIST", " , \n")
+	assert.Empty(payloadAllowlist())
+}
+
+func TestDecodePayload(t *testing.T) {
+	assert := assert.New(t)
+
+	limits := payloadLimits{MaxBytes: 1024, MaxDepth: 4, MaxTokens: 64}
+	parsed, err := decodePayload([]byte(`{"id":1234,"customer":{"email":"shopper@example.com"},"line_items":[{"id":1}]}`), limits)
+	assert.Nil(err)
+	assert.Equal("shopper@example.com", readMap(parsed, "customer", "email"))
+
+	_, err = decodePayload([]byte(`{"id":`), limits)
+	assert.NotNil(err)
+	_, err = decodePayload([]byte(`[1,2,3]`), limits)
+	assert.NotNil(err, "a payload must be an object")
+}
+
+func TestDecodePayloadDepth(t *testing.T) {
+	assert := assert.New(t)
+
+	limits := payloadLimits{MaxDepth: 4}
+	_, err := decodePayload([]byte(`{"a":{"b":{"c":[1]}}}`), limits)
+	assert.Nil(err)
+
+	nested := strings.Repeat(`{"a":`, 5) + "1" + strings.Repeat("}", 5)
+	_, err = decodePayload([]byte(nested), limits)
+	assert.NotNil(err)
+	assert.Contains("nested deeper", err.Error())
+
+	bomb := strings.Repeat("[", 100000) + strings.Repeat("]", 100000)
+	_, err = decodePayload([]byte(`{"a":`+bomb+`}`), payloadLimits{MaxDepth: defaultPayloadMaxDepth})
+	assert.NotNil(err)
+	assert.Contains("nested deeper", err.Error())
+}
+
+func TestDecodePayloadSize(t *testing.T) {
+	assert := assert.New(t)
+
+	huge := `{"note":"` + strings.Repeat("x", 2048) + `"}`
+	_, err := decodePayload([]byte(huge), payloadLimits{MaxBytes: 1024})
+	assert.NotNil(err)
+	assert.Contains("bytes", err.Error())
+
+	_, err = decodePayload([]byte(huge), payloadLimits{})
+	assert.Nil(err, "limits less than 1 aren't enforced")
+
+	wide := `{"tags":[` + strings.TrimSuffix(strings.Repeat(`1,`, 100), ",") + `]}`
+	_, err = decodePayload([]byte(wide), payloadLimits{MaxTokens: 50})
+	assert.NotNil(err)
+	assert.Contains("tokens", err.Error())
+}
+
+func TestPayloadLimitsRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer os.Setenv("PAYLOAD_MAX_DEPTH", os.Getenv("PAYLOAD_MAX_DEPTH"))
+	os.Setenv("PAYLOAD_MAX_DEPTH", "3")
+
+	app := newApp()
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").
+		WithPostBody([]byte(`{"id":1,"note_attributes":[{"value":{"nested":{}}}]}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+	assert.Empty(captured.Requests())
+}
@@ -0,0 +1,101 @@
+package main
+
+import (
+	"bytes"
+	"reflect"
+	"sync"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// variantSnapshots holds the last seen price and inventory of every variant, to diff product updates against.
+var variantSnapshots = newVariantSnapshotStore()
+
+// variantSnapshot is the state of a variant as of its last product update.
+type variantSnapshot struct {
+	Price     interface{}
+	Inventory interface{}
+}
+
+// variantChange is a variant whose price or inventory changed between product updates.
+type variantChange struct {
+	ID       interface{}
+	Title    interface{}
+	Previous variantSnapshot
+	Current  variantSnapshot
+}
+
+func newVariantSnapshotStore() *variantSnapshotStore {
+	return &variantSnapshotStore{snapshots: map[string]variantSnapshot{}}
+}
+
+// variantSnapshotStore tracks variant state across product updates.
+type variantSnapshotStore struct {
+	sync.Mutex
+	snapshots map[string]variantSnapshot
+}
+
+// Update records the product's variants and returns those whose price or inventory changed since they
+// were last seen. Variants seen for the first time aren't changes.
+func (vss *variantSnapshotStore) Update(product map[string]interface{}) []variantChange {
+	vss.Lock()
+	defer vss.Unlock()
+
+	var changes []variantChange
+	for _, variant := range readMapSlice(product, "variants") {
+		id := variant["id"]
+		if id == nil {
+			continue
+		}
+		key := messagef("%v", id)
+		current := variantSnapshot{Price: variant["price"], Inventory: variant["inventory_quantity"]}
+
+		if previous, hasPrevious := vss.snapshots[key]; hasPrevious && !reflect.DeepEqual(previous, current) {
+			changes = append(changes, variantChange{ID: id, Title: variant["title"], Previous: previous, Current: current})
+		}
+		vss.snapshots[key] = current
+	}
+	return changes
+}
+
+func productAction(rc *web.RequestContext) web.ControllerResult {
+	parsed, err := decodePayload(rc.PostBody(), payloadDecodeLimits())
+	if err != nil {
+		return rc.API().BadRequest(err.Error())
+	}
+	changes := variantSnapshots.Update(parsed)
+	if len(changes) == 0 {
+		return rc.JSON(ok)
+	}
+
+	err = notify(&notification{
+		Topic:    "products/update",
+		Text:     productText(shopDomain(rc), parsed, changes),
+		Username: "Shopify (Product Update)",
+		IconURL:  shopifyIconURL,
+		Payload:  allowedPayload(parsed),
+	})
+	if err != nil {
+		return rc.API().InternalError(err)
+	}
+
+	return rc.JSON(ok)
+}
+
+// productText summarizes the variants of a product whose price or inventory changed. The changes are of
+// the full payload, the product is echoed through `PAYLOAD_ALLOWLIST`.
+func productText(shop string, parsed map[string]interface{}, changes []variantChange) string {
+	echoed := allowedPayload(parsed)
+	buffer := bytes.NewBuffer(nil)
+	buffer.WriteString(messagef(":package: Product Updated! <%s|%v>", adminLink(shop, "products", echoed["id"]), echoed["title"]))
+	for _, change := range changes {
+		buffer.WriteString(messagef("\n• %v:", change.Title))
+		if !reflect.DeepEqual(change.Previous.Price, change.Current.Price) {
+			buffer.WriteString(messagef(" price %v → %v", change.Previous.Price, change.Current.Price))
+		}
+		if !reflect.DeepEqual(change.Previous.Inventory, change.Current.Inventory) {
+			buffer.WriteString(messagef(" inventory %v → %v", change.Previous.Inventory, change.Current.Inventory))
+		}
+	}
+	return buffer.String()
+}
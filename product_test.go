@@ -0,0 +1,100 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+)
+
+const sampleProductUpdate = `{
+	"id": 788032119674292900,
+	"title": "Example T-Shirt",
+	"variants": [
+		{"id": 642667041472713900, "product_id": 788032119674292900, "title": "Small", "price": "19.99", "inventory_quantity": 75},
+		{"id": 757650484644203900, "product_id": 788032119674292900, "title": "Medium", "price": "19.99", "inventory_quantity": 50}
+	]
+}`
+
+func TestReadMapSlice(t *testing.T) {
+	assert := assert.New(t)
+
+	var product map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(sampleProductUpdate), &product))
+
+	variants := readMapSlice(product, "variants")
+	assert.Len(variants, 2)
+	assert.Equal("Small", variants[0]["title"])
+	assert.Equal("Medium", variants[1]["title"])
+
+	assert.Empty(readMapSlice(product, "title"))
+	assert.Empty(readMapSlice(product, "images"))
+}
+
+func TestProductActionPostsVariantChanges(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func() { variantSnapshots = newVariantSnapshotStore() }()
+	variantSnapshots = newVariantSnapshotStore()
+
+	app := newApp()
+	res, err := app.Mock().WithVerb("POST").WithPathf("/product").WithPostBody([]byte(sampleProductUpdate)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Empty(captured.Requests(), "the first update has nothing to diff against")
+
+	updated := strings.Replace(sampleProductUpdate, `"price": "19.99", "inventory_quantity": 75`, `"price": "24.99", "inventory_quantity": 75`, 1)
+	updated = strings.Replace(updated, `"inventory_quantity": 50`, `"inventory_quantity": 48`, 1)
+	res, err = app.Mock().WithVerb("POST").WithPathf("/product").WithPostBody([]byte(updated)).
+		WithHeader("X-Shopify-Shop-Domain", "example.myshopify.com").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Len(captured.Requests(), 1)
+
+	var body map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &body))
+	text := body["text"].(string)
+	assert.Contains("<https://example.myshopify.com/admin/products/788032119674292900|Example T-Shirt>", text)
+	assert.Contains("• Small: price 19.99 → 24.99", text)
+	assert.Contains("• Medium: inventory 50 → 48", text)
+	assert.False(strings.Contains(text, "Small: price 19.99 → 24.99 inventory"))
+
+	// an unchanged update doesn't post
+	res, err = app.Mock().WithVerb("POST").WithPathf("/product").WithPostBody([]byte(updated)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Len(captured.Requests(), 1)
+}
+
+func TestProductActionAllowlist(t *testing.T) {
+	assert := assert.New(t)
+	defer os.Setenv("PAYLOAD_ALLOWLIST", os.Getenv("PAYLOAD_ALLOWLIST"))
+	os.Setenv("PAYLOAD_ALLOWLIST", "id")
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func() { variantSnapshots = newVariantSnapshotStore() }()
+	variantSnapshots = newVariantSnapshotStore()
+
+	app := newApp()
+	res, err := app.Mock().WithVerb("POST").WithPathf("/product").WithPostBody([]byte(sampleProductUpdate)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	updated := strings.Replace(sampleProductUpdate, `"inventory_quantity": 50`, `"inventory_quantity": 48`, 1)
+	res, err = app.Mock().WithVerb("POST").WithPathf("/product").WithPostBody([]byte(updated)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	assert.Len(captured.Requests(), 1, "variants are diffed even though they aren't allowlisted")
+
+	var body map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &body))
+	text := body["text"].(string)
+	assert.Contains("• Medium: inventory 50 → 48", text)
+	assert.False(strings.Contains(text, "Example T-Shirt"), "the product's title isn't allowlisted")
+}
@@ -0,0 +1,148 @@
+package main
+
+import (
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+
+	"github.com/blendlabs/go-util"
+)
+
+const (
+	defaultQueueCapacity = 256
+
+	queueFullPolicyBlock = "block"
+	queueFullPolicyDrop  = "drop"
+
+	deliveryModeSync  = "sync"
+	deliveryModeAsync = "async"
+)
+
+// errDeliveryQueueFull is the dead-letter error for notifications dropped by a full queue.
+var errDeliveryQueueFull = fmt.Errorf("delivery queue full")
+
+// _deliveryQueue, if set, is the queue `notify` hands notifications to instead of delivering them
+// while the webhook request waits. It is started by `main` in the `async` delivery mode.
+var _deliveryQueue *deliveryQueue
+
+// deliveryMode returns how webhook handlers deliver notifications, from `DELIVERY_MODE`: `async` (the
+// default) queues them and responds immediately, dead-lettering any that fail, and `sync` waits for
+// every notifier, responding with an error aggregating their failures.
+func deliveryMode() string {
+	return util.EmptyCoalesce(strings.ToLower(os.Getenv("DELIVERY_MODE")), deliveryModeAsync)
+}
+
+// validateDeliveryMode returns an error for a delivery mode other than `sync` or `async`.
+func validateDeliveryMode(mode string) error {
+	switch mode {
+	case deliveryModeSync, deliveryModeAsync:
+		return nil
+	default:
+		return fmt.Errorf("`DELIVERY_MODE` must be `%s` or `%s`, got `%s`", deliveryModeSync, deliveryModeAsync, mode)
+	}
+}
+
+// startDeliveryQueue starts the delivery queue for the `async` delivery mode, and returns nil for `sync`.
+func startDeliveryQueue(mode string) *deliveryQueue {
+	if mode != deliveryModeAsync {
+		return nil
+	}
+	queue := newDeliveryQueue(queueCapacity(), queueFullPolicy(), func(n *notification) error {
+		return deliver(n, deliveryRetryPolicy())
+	})
+	queue.Start()
+	return queue
+}
+
+// queueCapacity returns the most notifications waiting for delivery, from `QUEUE_CAPACITY`.
+func queueCapacity() int {
+	capacity := envInt("QUEUE_CAPACITY", defaultQueueCapacity)
+	if capacity < 0 {
+		return 0
+	}
+	return capacity
+}
+
+// queueFullPolicy returns what happens to a notification when the queue is full, from `QUEUE_FULL_POLICY`:
+// `block` (the default) waits for room, holding the webhook request, and `drop` dead-letters it.
+func queueFullPolicy() string {
+	return util.EmptyCoalesce(strings.ToLower(os.Getenv("QUEUE_FULL_POLICY")), queueFullPolicyBlock)
+}
+
+// validateQueueFullPolicy returns an error for a queue full policy other than `block` or `drop`.
+func validateQueueFullPolicy(policy string) error {
+	switch policy {
+	case queueFullPolicyBlock, queueFullPolicyDrop:
+		return nil
+	default:
+		return fmt.Errorf("`QUEUE_FULL_POLICY` must be `%s` or `%s`, got `%s`", queueFullPolicyBlock, queueFullPolicyDrop, policy)
+	}
+}
+
+func newDeliveryQueue(capacity int, policy string, deliver func(*notification) error) *deliveryQueue {
+	return &deliveryQueue{
+		policy:  policy,
+		deliver: deliver,
+		items:   make(chan *notification, capacity),
+		done:    make(chan struct{}),
+	}
+}
+
+// deliveryQueue delivers notifications on a worker goroutine, so webhook handlers can respond to
+// shopify without waiting on slack.
+type deliveryQueue struct {
+	sync.RWMutex
+	policy  string
+	deliver func(*notification) error
+	items   chan *notification
+	done    chan struct{}
+	closed  bool
+}
+
+// Start starts the worker.
+func (dq *deliveryQueue) Start() {
+	go func() {
+		defer close(dq.done)
+		for n := range dq.items {
+			dq.deliver(n)
+		}
+	}()
+}
+
+// Enqueue queues a notification for delivery. If the queue is full it waits for room, or with the
+// `drop` policy returns `errDeliveryQueueFull`; it also returns an error once the queue is closed.
+func (dq *deliveryQueue) Enqueue(n *notification) error {
+	dq.RLock()
+	defer dq.RUnlock()
+	if dq.closed {
+		return fmt.Errorf("delivery queue closed")
+	}
+
+	if dq.policy == queueFullPolicyDrop {
+		select {
+		case dq.items <- n:
+			return nil
+		default:
+			return errDeliveryQueueFull
+		}
+	}
+	dq.items <- n
+	return nil
+}
+
+// Len returns the number of notifications waiting for delivery.
+func (dq *deliveryQueue) Len() int {
+	return len(dq.items)
+}
+
+// Close stops accepting notifications and waits for the worker to deliver those already queued.
+func (dq *deliveryQueue) Close() {
+	dq.Lock()
+	if !dq.closed {
+		dq.closed = true
+		close(dq.items)
+	}
+	dq.Unlock()
+	<-dq.done
+}
@@ -0,0 +1,227 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+func TestDeliveryQueueEnqueueReturnsFast(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	delivered := make(chan *notification, 1)
+	queue := newDeliveryQueue(4, queueFullPolicyBlock, func(n *notification) error {
+		<-release
+		delivered <- n
+		return nil
+	})
+	queue.Start()
+	defer queue.Close()
+
+	started := time.Now()
+	assert.Nil(queue.Enqueue(&notification{Text: "New Sale!"}))
+	assert.True(time.Since(started) < 100*time.Millisecond, "enqueue shouldn't wait on delivery")
+
+	close(release)
+	n := assert.ReceivesWithin(delivered, time.Second).(*notification)
+	assert.Equal("New Sale!", n.Text)
+}
+
+func TestDeliveryQueueRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	release := make(chan struct{})
+	delivered := make(chan error, 1)
+	defer func() { _deliveryQueue = nil }()
+	_deliveryQueue = newDeliveryQueue(4, queueFullPolicyBlock, func(n *notification) error {
+		<-release
+		err := deliver(n, &retryPolicy{Attempts: 1})
+		delivered <- err
+		return err
+	})
+	_deliveryQueue.Start()
+
+	app := newApp()
+	var result map[string]string
+	err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody([]byte(`{"id":450789469,"total_price":"12.50"}`)).JSON(&result)
+	assert.Nil(err)
+	assert.Equal(ok, result)
+	assert.Empty(captured.Requests(), "the handler shouldn't wait on slack")
+
+	close(release)
+	assert.Nil(assert.ReceivesWithin(delivered, time.Second))
+	assert.Len(captured.Requests(), 1)
+
+	var body map[string]interface{}
+	assert.Nil(json.Unmarshal(captured.Requests()[0].Body, &body))
+	assert.Contains("New Sale!", body["text"].(string))
+}
+
+func TestDeliveryQueueDropPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	defer func() { deadLetters = newDeadLetterStore(deadLetterCapacity) }()
+	deadLetters = newDeadLetterStore(deadLetterCapacity)
+	defer func() { _deliveryQueue = nil }()
+	_deliveryQueue = newDeliveryQueue(1, queueFullPolicyDrop, func(n *notification) error {
+		<-release
+		return nil
+	})
+
+	// without a worker the first notification fills the queue.
+	assert.Nil(notify(&notification{Text: "first"}))
+	assert.Equal(1, _deliveryQueue.Len())
+	assert.Nil(notify(&notification{Text: "second"}))
+	assert.Equal(1, _deliveryQueue.Len())
+
+	letters := deadLetters.Drain()
+	assert.Len(letters, 1)
+	assert.Equal("second", letters[0].Notification.Text)
+	assert.Equal(errDeliveryQueueFull.Error(), letters[0].Error)
+
+	close(release)
+	_deliveryQueue.Start()
+	_deliveryQueue.Close()
+}
+
+func TestDeliveryQueueCloseFlushes(t *testing.T) {
+	assert := assert.New(t)
+
+	var delivered []string
+	queue := newDeliveryQueue(8, queueFullPolicyBlock, func(n *notification) error {
+		time.Sleep(time.Millisecond)
+		delivered = append(delivered, n.Text)
+		return nil
+	})
+	for _, text := range []string{"one", "two", "three"} {
+		assert.Nil(queue.Enqueue(&notification{Text: text}))
+	}
+	queue.Start()
+	queue.Close()
+
+	assert.Equal([]string{"one", "two", "three"}, delivered)
+	assert.Zero(queue.Len())
+	assert.NotNil(queue.Enqueue(&notification{Text: "late"}))
+}
+
+func TestQueueFullPolicy(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("QUEUE_FULL_POLICY", os.Getenv("QUEUE_FULL_POLICY"))
+	os.Setenv("QUEUE_FULL_POLICY", "")
+	assert.Equal(queueFullPolicyBlock, queueFullPolicy())
+	os.Setenv("QUEUE_FULL_POLICY", "Drop")
+	assert.Equal(queueFullPolicyDrop, queueFullPolicy())
+
+	assert.Nil(validateQueueFullPolicy(queueFullPolicyBlock))
+	assert.Nil(validateQueueFullPolicy(queueFullPolicyDrop))
+	assert.NotNil(validateQueueFullPolicy("discard"))
+}
+
+// notifierFunc adapts a func to a notifier.
+type notifierFunc func(n *notification) error
+
+func (nf notifierFunc) Notify(n *notification) error {
+	return nf(n)
+}
+
+// fanOut returns two notifiers, the second of which always fails, and the texts each was sent.
+func fanOut() (notifier, *[]string, *[]string) {
+	var delivered, failed []string
+	var mutex sync.Mutex
+	return multiNotifier{
+		notifierFunc(func(n *notification) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			delivered = append(delivered, n.Text)
+			return nil
+		}),
+		notifierFunc(func(n *notification) error {
+			mutex.Lock()
+			defer mutex.Unlock()
+			failed = append(failed, n.Text)
+			return fmt.Errorf("discord is down")
+		}),
+	}, &delivered, &failed
+}
+
+func TestDeliveryModeSync(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(n notifier) { _notifier = n }(_notifier)
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 1}
+	defer func() { deadLetters = newDeadLetterStore(deadLetterCapacity) }()
+	deadLetters = newDeadLetterStore(deadLetterCapacity)
+
+	fanned, delivered, failed := fanOut()
+	_notifier = fanned
+	_deliveryQueue = startDeliveryQueue(deliveryModeSync)
+	assert.Nil(_deliveryQueue)
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody([]byte(`{"id":450789469,"total_price":"12.50"}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusInternalServerError, res.StatusCode, "the handler waits for every notifier")
+	contents, err := ioutil.ReadAll(res.Body)
+	assert.Nil(err)
+	assert.Contains("1 of 2 notifiers failed: discord is down", string(contents))
+	assert.Len(*delivered, 1)
+	assert.Len(*failed, 1)
+}
+
+func TestDeliveryModeAsync(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(n notifier) { _notifier = n }(_notifier)
+	defer func(policy *retryPolicy) { _deliveryRetryPolicy = policy }(deliveryRetryPolicy())
+	_deliveryRetryPolicy = &retryPolicy{Attempts: 1}
+	defer func() { deadLetters = newDeadLetterStore(deadLetterCapacity) }()
+	deadLetters = newDeadLetterStore(deadLetterCapacity)
+
+	fanned, delivered, failed := fanOut()
+	_notifier = fanned
+	defer func() { _deliveryQueue = nil }()
+	_deliveryQueue = startDeliveryQueue(deliveryModeAsync)
+	assert.NotNil(_deliveryQueue)
+
+	app := newApp()
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody([]byte(`{"id":450789469,"total_price":"12.50"}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode, "the handler doesn't wait on notifiers")
+
+	_deliveryQueue.Close()
+	assert.Len(*delivered, 1)
+	assert.Len(*failed, 1)
+	letters := deadLetters.Drain()
+	assert.Len(letters, 1)
+	assert.Contains("discord is down", letters[0].Error)
+}
+
+func TestDeliveryMode(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("DELIVERY_MODE", os.Getenv("DELIVERY_MODE"))
+	os.Setenv("DELIVERY_MODE", "")
+	assert.Equal(deliveryModeAsync, deliveryMode())
+	os.Setenv("DELIVERY_MODE", "SYNC")
+	assert.Equal(deliveryModeSync, deliveryMode())
+
+	assert.Nil(validateDeliveryMode(deliveryModeSync))
+	assert.Nil(validateDeliveryMode(deliveryModeAsync))
+	assert.NotNil(validateDeliveryMode("batch"))
+}
@@ -0,0 +1,72 @@
+package main
+
+import (
+	"bytes"
+
+	"github.com/wcharczuk/go-web"
+)
+
+func refundAction(rc *web.RequestContext) web.ControllerResult {
+	parsed, err := decodePayload(rc.PostBody(), payloadDecodeLimits())
+	if err != nil {
+		return rc.API().BadRequest(err.Error())
+	}
+	err = notify(&notification{
+		Topic:    "refunds/create",
+		Text:     refundText(shopDomain(rc), parsed),
+		Username: "Shopify (Refund)",
+		IconURL:  shopifyIconURL,
+		Payload:  allowedPayload(parsed),
+	})
+	if err != nil {
+		return rc.API().InternalError(err)
+	}
+
+	return rc.JSON(ok)
+}
+
+// refundText formats a refund with its amount and a line per returned item, linking to its order. The
+// amount is of the full payload, the order and items are echoed through `PAYLOAD_ALLOWLIST`.
+func refundText(shop string, parsed map[string]interface{}) string {
+	echoed := allowedPayload(parsed)
+	buffer := bytes.NewBuffer(nil)
+	buffer.WriteString(messagef(
+		`:money_with_wings: Refund!
+                %s refunded on <%s|order %v>`,
+		refundAmount(parsed),
+		adminLink(shop, "orders", echoed["order_id"]),
+		echoed["order_id"],
+	))
+	for _, item := range readMapSlice(echoed, "refund_line_items") {
+		buffer.WriteString(messagef("\n• %v × %s", readMapInt(item, "quantity"), readMapString(item, "line_item", "title")))
+		if subtotal := readMapMoney(item, "subtotal"); len(subtotal) > 0 {
+			buffer.WriteString(messagef(" (%s)", subtotal))
+		}
+	}
+	return buffer.String()
+}
+
+// refundAmount returns the total of the refund's `refund` transactions, which is what was paid back,
+// falling back to the subtotals of its line items if it has none.
+func refundAmount(parsed map[string]interface{}) money {
+	var total money
+	var hasTransactions bool
+	for _, transaction := range readMapSlice(parsed, "transactions") {
+		if readMapString(transaction, "kind") != "refund" {
+			continue
+		}
+		if amount, err := parseMoney(readMap(transaction, "amount")); err == nil {
+			total += amount
+			hasTransactions = true
+		}
+	}
+	if hasTransactions {
+		return total
+	}
+	for _, item := range readMapSlice(parsed, "refund_line_items") {
+		if subtotal, err := parseMoney(readMap(item, "subtotal")); err == nil {
+			total += subtotal
+		}
+	}
+	return total
+}
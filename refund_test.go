@@ -0,0 +1,95 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+const sampleRefund = `{
+	"id": 509562969,
+	"order_id": 450789469,
+	"note": "wrong size",
+	"refund_line_items": [
+		{"id": 104689539, "quantity": 1, "line_item_id": 703073504, "subtotal": "199.00", "line_item": {"id": 703073504, "title": "IPod Nano - 8gb", "price": "199.00"}},
+		{"id": 709875399, "quantity": 2, "line_item_id": 466157049, "subtotal": "0.10", "line_item": {"id": 466157049, "title": "Sticker", "price": "0.05"}}
+	],
+	"transactions": [
+		{"id": 179259969, "kind": "refund", "status": "success", "amount": "150.00"},
+		{"id": 179259970, "kind": "refund", "status": "success", "amount": "49.10"}
+	]
+}`
+
+func TestRefundText(t *testing.T) {
+	assert := assert.New(t)
+
+	var refund map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(sampleRefund), &refund))
+
+	assert.Equal(
+		":money_with_wings: Refund!\n                199.10 refunded on <https://kissandwear.com/admin/orders/450789469|order 450789469>"+
+			"\n• 1 × IPod Nano - 8gb (199.00)"+
+			"\n• 2 × Sticker (0.10)",
+		refundText("kissandwear.com", refund),
+	)
+}
+
+func TestRefundAmount(t *testing.T) {
+	assert := assert.New(t)
+
+	var refund map[string]interface{}
+	assert.Nil(json.Unmarshal([]byte(`{
+		"refund_line_items": [{"quantity": 1, "subtotal": "19.99"}, {"quantity": 3, "subtotal": "0.30"}],
+		"transactions": [{"kind": "sale", "amount": "100.00"}]
+	}`), &refund))
+	assert.Equal("20.29", refundAmount(refund).String(), "falls back to line item subtotals without refund transactions")
+
+	assert.Equal("0.00", refundAmount(map[string]interface{}{}).String())
+}
+
+func TestRefundRoute(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write([]byte(sampleRefund))
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/refund").WithPostBody([]byte(sampleRefund)).
+		WithHeader("X-Shopify-Hmac-Sha256", base64.StdEncoding.EncodeToString([]byte("forged"))).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+	assert.Empty(captured.Requests())
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/refund").WithPostBody([]byte(sampleRefund)).
+		WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/webhook").WithPostBody([]byte(sampleRefund)).
+		WithHeader("X-Shopify-Topic", "refunds/create").WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	requests := captured.Requests()
+	assert.Len(requests, 2)
+	var body map[string]interface{}
+	assert.Nil(json.Unmarshal(requests[0].Body, &body))
+	assert.Contains(":money_with_wings: Refund!", body["text"].(string))
+	assert.Contains("199.10 refunded on", body["text"].(string))
+	assert.Contains("• 2 × Sticker (0.10)", body["text"].(string))
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"encoding/json"
+	"strings"
+	"time"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// hmacValidStateKey is the request state `verifyWebHook` records whether the signature was valid under.
+const hmacValidStateKey = "hmac_valid"
+
+// webhookLogLine is the structured log line written for each webhook.
+type webhookLogLine struct {
+	Time       time.Time `json:"time"`
+	Route      string    `json:"route"`
+	Status     int       `json:"status"`
+	Topic      string    `json:"topic"`
+	HMACValid  *bool     `json:"hmac_valid"`
+	DurationMS float64   `json:"duration_ms"`
+}
+
+// logWebhook writes one json line per webhook to the app logger with its route, response status,
+// `X-Shopify-Topic`, whether its signature was valid (null if it wasn't checked) and how long it took.
+func logWebhook(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		started := time.Now()
+		result := action(rc)
+
+		line := webhookLogLine{
+			Time:       started.UTC(),
+			Route:      rc.Request.URL.Path,
+			Status:     resultStatusCode(result),
+			Topic:      strings.TrimSpace(rc.Request.Header.Get("X-Shopify-Topic")),
+			DurationMS: float64(time.Since(started)) / float64(time.Millisecond),
+		}
+		if valid, isBool := rc.State(hmacValidStateKey).(bool); isBool {
+			line.HMACValid = &valid
+		}
+
+		if logger := rc.Logger(); logger != nil {
+			if contents, err := json.Marshal(line); err == nil {
+				logger.Write(string(contents))
+			}
+		}
+		return result
+	}
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/wcharczuk/go-web"
+)
+
+// webhookLogLines returns the json lines in a log, skipping anything else the app logged.
+func webhookLogLines(assert *assert.Assertions, output string) []map[string]interface{} {
+	var lines []map[string]interface{}
+	for _, line := range strings.Split(output, "\n") {
+		if !strings.HasPrefix(line, "{") {
+			continue
+		}
+		var parsed map[string]interface{}
+		assert.Nil(json.Unmarshal([]byte(line), &parsed))
+		lines = append(lines, parsed)
+	}
+	return lines
+}
+
+func TestLogWebhook(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func() { _sharedSecret = nil }()
+	_sharedSecret = []byte("shhh")
+
+	output := bytes.NewBuffer(nil)
+	app := newApp()
+	app.SetLogger(web.NewLogger(output, ioutil.Discard))
+
+	body := []byte(`{"id":450789469,"total_price":"12.50"}`)
+	mac := hmac.New(sha256.New, _sharedSecret)
+	mac.Write(body)
+	signature := base64.StdEncoding.EncodeToString(mac.Sum(nil))
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody(body).
+		WithHeader("X-Shopify-Topic", "orders/create").WithHeader("X-Shopify-Hmac-Sha256", signature).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/shopper").WithPostBody(body).
+		WithHeader("X-Shopify-Topic", "customers/create").WithHeader("X-Shopify-Hmac-Sha256", "Zm9yZ2Vk").Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	lines := webhookLogLines(assert, output.String())
+	assert.Len(lines, 2)
+	for _, line := range lines {
+		for _, key := range []string{"time", "route", "status", "topic", "hmac_valid", "duration_ms"} {
+			_, hasKey := line[key]
+			assert.True(hasKey, key)
+		}
+	}
+
+	assert.Equal("/order", lines[0]["route"])
+	assert.Equal(float64(http.StatusOK), lines[0]["status"])
+	assert.Equal("orders/create", lines[0]["topic"])
+	assert.Equal(true, lines[0]["hmac_valid"])
+
+	assert.Equal("/shopper", lines[1]["route"])
+	assert.Equal(float64(http.StatusBadRequest), lines[1]["status"])
+	assert.Equal("customers/create", lines[1]["topic"])
+	assert.Equal(false, lines[1]["hmac_valid"])
+}
+
+func TestLogWebhookUnsigned(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+
+	output := bytes.NewBuffer(nil)
+	app := newApp()
+	app.SetLogger(web.NewLogger(output, ioutil.Discard))
+
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithPostBody([]byte(`{"id":1}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	lines := webhookLogLines(assert, output.String())
+	assert.Len(lines, 1)
+	assert.Nil(lines[0]["hmac_valid"], "the signature isn't checked without a shared secret")
+}
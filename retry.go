@@ -0,0 +1,189 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const (
+	defaultRetryAttempts   = 3
+	defaultRetryBaseDelay  = 250 * time.Millisecond
+	defaultRetryMaxDelay   = 2 * time.Second
+	defaultRetryMaxElapsed = 4 * time.Second
+)
+
+var (
+	_deliveryRetryPolicy     *retryPolicy
+	_deliveryRetryPolicyOnce sync.Once
+)
+
+// deliveryRetryPolicy returns the retry policy for delivering notifications, read from the environment:
+//
+//   - `RETRY_ATTEMPTS` is the most attempts made, including the first (default 3).
+//   - `RETRY_BASE_DELAY` is the delay before the first retry, doubling each retry after (default 250ms).
+//   - `RETRY_MAX_DELAY` caps the delay before any one retry (default 2s).
+//   - `RETRY_MAX_ELAPSED` is the total time budget across every attempt and delay (default 4s).
+//
+// Retries stop at whichever limit is reached first, and the notification is dead-lettered. Without the
+// delivery queue, deliveries run while the webhook request waits, so the budget should stay under the
+// sender's timeout (5s for Shopify). It's built once, since queue workers can race to the first delivery.
+func deliveryRetryPolicy() *retryPolicy {
+	_deliveryRetryPolicyOnce.Do(func() {
+		if _deliveryRetryPolicy != nil {
+			return
+		}
+		_deliveryRetryPolicy = &retryPolicy{
+			Attempts:   envInt("RETRY_ATTEMPTS", defaultRetryAttempts),
+			BaseDelay:  envDuration("RETRY_BASE_DELAY", defaultRetryBaseDelay),
+			MaxDelay:   envDuration("RETRY_MAX_DELAY", defaultRetryMaxDelay),
+			MaxElapsed: envDuration("RETRY_MAX_ELAPSED", defaultRetryMaxElapsed),
+		}
+	})
+	return _deliveryRetryPolicy
+}
+
+// retryPolicy retries an action with capped exponential backoff, within an attempt count and a total time budget.
+type retryPolicy struct {
+	// Attempts is the most attempts made, including the first; less than 1 is treated as 1.
+	Attempts int
+	// BaseDelay is the delay before the first retry, doubling each retry after.
+	BaseDelay time.Duration
+	// MaxDelay, if set, caps the delay before any one retry.
+	MaxDelay time.Duration
+	// MaxElapsed, if set, is the total time budget; no retry is started whose delay would exceed it.
+	MaxElapsed time.Duration
+	// Allow, if set, is asked before each retry, and retrying stops if it returns false.
+	Allow func() bool
+
+	now   func() time.Time
+	sleep func(time.Duration)
+}
+
+// Do calls `action` until it succeeds or the policy is exhausted, returning the last error.
+// Errors marked with `permanent` aren't retried, and errors marked with `retryAfter` wait at least
+// as long as they ask before the next attempt.
+func (rp *retryPolicy) Do(action func() error) error {
+	now, sleep := rp.now, rp.sleep
+	if now == nil {
+		now = time.Now
+	}
+	if sleep == nil {
+		sleep = time.Sleep
+	}
+
+	started := now()
+	var err error
+	for attempt := 1; ; attempt++ {
+		if err = action(); err == nil {
+			return nil
+		}
+		if _, isPermanent := err.(*permanentError); isPermanent || attempt >= rp.Attempts {
+			return err
+		}
+
+		delay := rp.delay(attempt)
+		if typed, isRetryAfter := err.(*retryAfterError); isRetryAfter && typed.Delay > delay {
+			delay = typed.Delay
+		}
+		if rp.MaxElapsed > 0 && now().Sub(started)+delay > rp.MaxElapsed {
+			return err
+		}
+		if rp.Allow != nil && !rp.Allow() {
+			return err
+		}
+		sleep(delay)
+	}
+}
+
+// delay returns the backoff before retrying after the given attempt.
+func (rp *retryPolicy) delay(attempt int) time.Duration {
+	delay := rp.BaseDelay
+	for x := 1; x < attempt; x++ {
+		delay = delay * 2
+		if rp.MaxDelay > 0 && delay > rp.MaxDelay {
+			break
+		}
+	}
+	if rp.MaxDelay > 0 && delay > rp.MaxDelay {
+		return rp.MaxDelay
+	}
+	return delay
+}
+
+// permanent marks an error as not worth retrying, either because it never will succeed or because
+// the action already retried it.
+func permanent(err error) error {
+	if err == nil {
+		return nil
+	}
+	if _, isPermanent := err.(*permanentError); isPermanent {
+		return err
+	}
+	return &permanentError{Err: err}
+}
+
+// permanentError is an error a retryPolicy returns without retrying.
+type permanentError struct {
+	Err error
+}
+
+func (pe *permanentError) Error() string {
+	return pe.Err.Error()
+}
+
+// retryAfter marks an error as retryable no sooner than `delay` from now, like a `Retry-After` asks.
+func retryAfter(err error, delay time.Duration) error {
+	if err == nil || delay <= 0 {
+		return err
+	}
+	return &retryAfterError{Err: err, Delay: delay}
+}
+
+// retryAfterError is an error a retryPolicy waits at least `Delay` to retry.
+type retryAfterError struct {
+	Err   error
+	Delay time.Duration
+}
+
+func (rae *retryAfterError) Error() string {
+	return rae.Err.Error()
+}
+
+// parseRetryAfter returns the delay a `Retry-After` header value asks for, given either as seconds
+// or as an http date, or zero if it is empty or invalid.
+func parseRetryAfter(value string, now time.Time) time.Duration {
+	if len(value) == 0 {
+		return 0
+	}
+	if seconds, err := strconv.Atoi(value); err == nil {
+		if seconds < 0 {
+			return 0
+		}
+		return time.Duration(seconds) * time.Second
+	}
+	if at, err := http.ParseTime(value); err == nil && at.After(now) {
+		return at.Sub(now)
+	}
+	return 0
+}
+
+// envInt returns the environment variable as an int, or the default if it is unset or invalid.
+func envInt(name string, defaultValue int) int {
+	value, err := strconv.Atoi(os.Getenv(name))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
+
+// envDuration returns the environment variable as a duration like `500ms`, or the default if it is unset or invalid.
+func envDuration(name string, defaultValue time.Duration) time.Duration {
+	value, err := time.ParseDuration(os.Getenv(name))
+	if err != nil {
+		return defaultValue
+	}
+	return value
+}
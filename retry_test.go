@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+// fakeClock is a clock whose sleeps advance it instantly.
+type fakeClock struct {
+	current time.Time
+	slept   []time.Duration
+}
+
+func (fc *fakeClock) Now() time.Time {
+	return fc.current
+}
+
+func (fc *fakeClock) Sleep(d time.Duration) {
+	fc.slept = append(fc.slept, d)
+	fc.current = fc.current.Add(d)
+}
+
+func TestRetryPolicyBackoffCap(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Now()}
+	policy := &retryPolicy{Attempts: 5, BaseDelay: time.Second, MaxDelay: 3 * time.Second, now: clock.Now, sleep: clock.Sleep}
+
+	var attempts int
+	err := policy.Do(func() error {
+		attempts++
+		return fmt.Errorf("slack is down")
+	})
+	assert.NotNil(err)
+	assert.Equal(5, attempts)
+	assert.Equal([]time.Duration{time.Second, 2 * time.Second, 3 * time.Second, 3 * time.Second}, clock.slept)
+}
+
+func TestRetryPolicyMaxElapsed(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Now()}
+	policy := &retryPolicy{Attempts: 10, BaseDelay: time.Second, MaxDelay: 4 * time.Second, MaxElapsed: 8 * time.Second, now: clock.Now, sleep: clock.Sleep}
+
+	var attempts int
+	err := policy.Do(func() error {
+		attempts++
+		clock.current = clock.current.Add(500 * time.Millisecond)
+		return fmt.Errorf("slack is down")
+	})
+	assert.NotNil(err)
+	// 0.5s + 1s + 0.5s + 2s + 0.5s = 4.5s elapsed after three attempts, and the next 4s delay would exceed the budget.
+	assert.Equal(3, attempts)
+	assert.Equal([]time.Duration{time.Second, 2 * time.Second}, clock.slept)
+}
+
+func TestRetryPolicySucceeds(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Now()}
+	policy := &retryPolicy{Attempts: 3, BaseDelay: time.Second, now: clock.Now, sleep: clock.Sleep}
+
+	var attempts int
+	err := policy.Do(func() error {
+		attempts++
+		if attempts < 2 {
+			return fmt.Errorf("slack is down")
+		}
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(2, attempts)
+	assert.Len(clock.slept, 1)
+}
+
+func TestRetryPolicyPermanent(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Now()}
+	policy := &retryPolicy{Attempts: 3, BaseDelay: time.Second, now: clock.Now, sleep: clock.Sleep}
+
+	var attempts int
+	err := policy.Do(func() error {
+		attempts++
+		return permanent(fmt.Errorf("invalid_payload"))
+	})
+	assert.NotNil(err)
+	assert.Equal("invalid_payload", err.Error())
+	assert.Equal(1, attempts)
+	assert.Empty(clock.slept)
+}
+
+func TestRetryPolicyRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Now()}
+	policy := &retryPolicy{Attempts: 3, BaseDelay: time.Second, MaxDelay: 2 * time.Second, now: clock.Now, sleep: clock.Sleep}
+
+	var attempts int
+	err := policy.Do(func() error {
+		attempts++
+		if attempts == 1 {
+			return retryAfter(fmt.Errorf("rate_limited"), 5*time.Second)
+		}
+		if attempts == 2 {
+			return retryAfter(fmt.Errorf("rate_limited"), 100*time.Millisecond)
+		}
+		return nil
+	})
+	assert.Nil(err)
+	assert.Equal(3, attempts)
+	// the retry after exceeds the max delay, but a shorter one doesn't cut the backoff short.
+	assert.Equal([]time.Duration{5 * time.Second, 2 * time.Second}, clock.slept)
+}
+
+func TestParseRetryAfter(t *testing.T) {
+	assert := assert.New(t)
+
+	now := time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)
+	assert.Equal(30*time.Second, parseRetryAfter("30", now))
+	assert.Equal(90*time.Second, parseRetryAfter(now.Add(90*time.Second).Format(http.TimeFormat), now))
+	assert.Zero(parseRetryAfter("", now))
+	assert.Zero(parseRetryAfter("-1", now))
+	assert.Zero(parseRetryAfter("soon", now))
+	assert.Zero(parseRetryAfter(now.Add(-time.Minute).Format(http.TimeFormat), now))
+}
+
+func TestRetryPolicyAllow(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Now()}
+	allowed := 1
+	policy := &retryPolicy{Attempts: 5, BaseDelay: time.Second, now: clock.Now, sleep: clock.Sleep, Allow: func() bool {
+		allowed--
+		return allowed >= 0
+	}}
+
+	var attempts int
+	err := policy.Do(func() error {
+		attempts++
+		return fmt.Errorf("slack is down")
+	})
+	assert.NotNil(err)
+	assert.Equal(2, attempts)
+	assert.Len(clock.slept, 1)
+}
+
+func TestDeliveryRetryPolicyBuiltOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("RETRY_ATTEMPTS", os.Getenv("RETRY_ATTEMPTS"))
+	os.Setenv("RETRY_ATTEMPTS", "5")
+	defer func(policy *retryPolicy) {
+		_deliveryRetryPolicy, _deliveryRetryPolicyOnce = policy, sync.Once{}
+	}(_deliveryRetryPolicy)
+	_deliveryRetryPolicy, _deliveryRetryPolicyOnce = nil, sync.Once{}
+
+	policies := make(chan *retryPolicy, 8)
+	var wg sync.WaitGroup
+	for index := 0; index < cap(policies); index++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			policies <- deliveryRetryPolicy()
+		}()
+	}
+	wg.Wait()
+	close(policies)
+
+	first := <-policies
+	assert.NotNil(first)
+	assert.Equal(5, first.Attempts)
+	for policy := range policies {
+		assert.True(policy == first, "every caller gets the same policy")
+	}
+}
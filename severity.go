@@ -0,0 +1,115 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/blendlabs/go-util"
+)
+
+// severity ranks how urgently a topic's notifications need attention.
+type severity int
+
+const (
+	severityInfo severity = iota
+	severityWarning
+	severityError
+	severityCritical
+)
+
+var severityNames = map[severity]string{
+	severityInfo:     "info",
+	severityWarning:  "warning",
+	severityError:    "error",
+	severityCritical: "critical",
+}
+
+// String returns the severity's name.
+func (s severity) String() string {
+	if name, hasName := severityNames[s]; hasName {
+		return name
+	}
+	return fmt.Sprintf("severity(%d)", int(s))
+}
+
+// parseSeverity returns the severity named `name`, ignoring case.
+func parseSeverity(name string) (severity, error) {
+	name = strings.ToLower(strings.TrimSpace(name))
+	for s, severityName := range severityNames {
+		if severityName == name {
+			return s, nil
+		}
+	}
+	return severityInfo, fmt.Errorf("unknown severity: %s, must be one of info, warning, error, critical", name)
+}
+
+// newSeverityNotifier returns a notifier routing each notification by its topic's severity, per
+// `topics`, formatted like `orders/cancelled=critical,refunds/create=warning`, and `routes`, formatted
+// like `info=slack,critical=pagerduty+slack`. Topics not listed are `info`; severities without a route
+// go to `fallback`.
+func newSeverityNotifier(topics, routes string, fallback notifier) (*severityNotifier, error) {
+	sn := &severityNotifier{Topics: map[string]severity{}, Routes: map[severity]notifier{}, Fallback: fallback}
+	for _, pair := range util.ParseList(topics) {
+		topic, name, err := splitPair(pair)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `TOPIC_SEVERITIES`: %v", err)
+		}
+		s, err := parseSeverity(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `TOPIC_SEVERITIES`: %v", err)
+		}
+		sn.Topics[strings.ToLower(topic)] = s
+	}
+	for _, pair := range util.ParseList(routes) {
+		name, notifiers, err := splitPair(pair)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `SEVERITY_NOTIFIERS`: %v", err)
+		}
+		s, err := parseSeverity(name)
+		if err != nil {
+			return nil, fmt.Errorf("invalid `SEVERITY_NOTIFIERS`: %v", err)
+		}
+		route, err := newNotifier(strings.Replace(notifiers, "+", ",", -1))
+		if err != nil {
+			return nil, fmt.Errorf("invalid `SEVERITY_NOTIFIERS`: %v", err)
+		}
+		sn.Routes[s] = route
+	}
+	return sn, nil
+}
+
+// splitPair splits a `key=value` pair, trimming both.
+func splitPair(pair string) (string, string, error) {
+	parts := strings.SplitN(pair, "=", 2)
+	if len(parts) != 2 || len(strings.TrimSpace(parts[0])) == 0 || len(strings.TrimSpace(parts[1])) == 0 {
+		return "", "", fmt.Errorf("%s, must be `key=value`", pair)
+	}
+	return strings.TrimSpace(parts[0]), strings.TrimSpace(parts[1]), nil
+}
+
+// severityNotifier escalates notifications by severity: each topic maps to a severity, and each
+// severity to the notifiers it reaches.
+type severityNotifier struct {
+	Topics   map[string]severity
+	Routes   map[severity]notifier
+	Fallback notifier
+}
+
+// Notify implements notifier. Routed notifications carry their severity, so notifiers with their own
+// notion of it, like pagerduty, use the one they were routed by.
+func (sn *severityNotifier) Notify(n *notification) error {
+	s := sn.severity(n.Topic)
+	if route, hasRoute := sn.Routes[s]; hasRoute {
+		routed := *n
+		routed.Severity = s.String()
+		return route.Notify(&routed)
+	}
+	return sn.Fallback.Notify(n)
+}
+
+func (sn *severityNotifier) severity(topic string) severity {
+	if s, hasSeverity := sn.Topics[strings.ToLower(topic)]; hasSeverity {
+		return s
+	}
+	return severityInfo
+}
@@ -0,0 +1,102 @@
+package main
+
+import (
+	"os"
+	"testing"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestParseSeverity(t *testing.T) {
+	assert := assert.New(t)
+
+	s, err := parseSeverity(" Critical ")
+	assert.Nil(err)
+	assert.Equal(severityCritical, s)
+	assert.Equal("critical", s.String())
+
+	_, err = parseSeverity("urgent")
+	assert.NotNil(err)
+}
+
+func TestSeverityNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	slack, pagerDuty, fallback := &countingNotifier{}, &countingNotifier{}, &countingNotifier{}
+	sn := &severityNotifier{
+		Topics: map[string]severity{"orders/cancelled": severityCritical, "products/update": severityWarning},
+		Routes: map[severity]notifier{
+			severityInfo:     slack,
+			severityCritical: multiNotifier{pagerDuty, slack},
+		},
+		Fallback: fallback,
+	}
+
+	assert.Nil(sn.Notify(&notification{Topic: "orders/cancelled", Text: "Order Cancelled!"}))
+	assert.Equal(1, pagerDuty.Calls, "critical topics page")
+	assert.Equal(1, slack.Calls, "critical topics reach slack too")
+
+	assert.Nil(sn.Notify(&notification{Topic: "orders/create", Text: "New Sale!"}))
+	assert.Equal(1, pagerDuty.Calls, "unlisted topics are info")
+	assert.Equal(2, slack.Calls)
+
+	assert.Nil(sn.Notify(&notification{Topic: "products/update", Text: "Product Updated!"}))
+	assert.Equal(1, fallback.Calls, "severities without a route go to the fallback")
+	assert.Equal(2, slack.Calls)
+}
+
+func TestNewSeverityNotifier(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("PAGERDUTY_ROUTING_KEY", os.Getenv("PAGERDUTY_ROUTING_KEY"))
+	os.Setenv("PAGERDUTY_ROUTING_KEY", "routing-key")
+
+	fallback := &countingNotifier{}
+	sn, err := newSeverityNotifier("orders/cancelled=critical, Refunds/Create=warning", "info=slack,critical=pagerduty+slack", fallback)
+	assert.Nil(err)
+	assert.Equal(severityCritical, sn.severity("orders/cancelled"))
+	assert.Equal(severityWarning, sn.severity("refunds/create"))
+	assert.Equal(severityInfo, sn.severity("orders/create"))
+
+	_, isSlack := sn.Routes[severityInfo].(*slackNotifier)
+	assert.True(isSlack)
+	critical, isMulti := sn.Routes[severityCritical].(multiNotifier)
+	assert.True(isMulti)
+	assert.Len(critical, 2)
+	_, isPagerDuty := critical[0].(*pagerDutyNotifier)
+	assert.True(isPagerDuty)
+
+	_, err = newSeverityNotifier("orders/cancelled", "", fallback)
+	assert.NotNil(err)
+	_, err = newSeverityNotifier("orders/cancelled=urgent", "", fallback)
+	assert.NotNil(err)
+	_, err = newSeverityNotifier("", "critical=carrier-pigeon", fallback)
+	assert.NotNil(err)
+}
+
+func TestNewConfiguredNotifierSeverityRoutes(t *testing.T) {
+	assert := assert.New(t)
+
+	for _, name := range []string{"NOTIFIER", "NOTIFIER_FALLBACKS", "TOPIC_SEVERITIES", "SEVERITY_NOTIFIERS"} {
+		defer os.Setenv(name, os.Getenv(name))
+	}
+	os.Setenv("NOTIFIER", "slack")
+	os.Setenv("NOTIFIER_FALLBACKS", "discord")
+	os.Setenv("TOPIC_SEVERITIES", "orders/cancelled=critical")
+	os.Setenv("SEVERITY_NOTIFIERS", "")
+	defer os.Setenv("DISCORD_WEBHOOK", os.Getenv("DISCORD_WEBHOOK"))
+	os.Setenv("DISCORD_WEBHOOK", "https://discord.com/api/webhooks/1/token")
+
+	n, err := newConfiguredNotifier()
+	assert.Nil(err)
+	_, isChain := n.(*fallbackNotifier)
+	assert.True(isChain, "severities aren't routed without `SEVERITY_NOTIFIERS`")
+
+	os.Setenv("SEVERITY_NOTIFIERS", "critical=stdout+slack")
+	n, err = newConfiguredNotifier()
+	assert.Nil(err)
+	sn, isSeverity := n.(*severityNotifier)
+	assert.True(isSeverity)
+	_, isChain = sn.Fallback.(*fallbackNotifier)
+	assert.True(isChain, "unrouted severities go to the chain")
+}
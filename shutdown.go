@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"net/http"
+	"time"
+)
+
+// defaultShutdownTimeout is how long shutdown waits for in-flight work before giving up.
+const defaultShutdownTimeout = 30 * time.Second
+
+// shutdownTimeout returns how long shutdown waits for in-flight work, from `SHUTDOWN_TIMEOUT`.
+func shutdownTimeout() time.Duration {
+	return envDuration("SHUTDOWN_TIMEOUT", defaultShutdownTimeout)
+}
+
+// drain stops the server taking webhooks and waits for in-flight handlers, then sends any signups held
+// for a digest and waits for the queue to deliver the notifications on it and for tee forwards to
+// finish. It gives up with an error once `timeout` passes; the queue can be nil.
+func drain(server *http.Server, queue *deliveryQueue, timeout time.Duration) error {
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	if err := server.Shutdown(ctx); err != nil {
+		return fmt.Errorf("shutdown: waiting on in-flight requests: %v", err)
+	}
+
+	drained := make(chan struct{})
+	go func() {
+		defer close(drained)
+		shopperDigest.Flush()
+		if queue != nil {
+			queue.Close()
+		}
+		teeInflight.Wait()
+	}()
+
+	select {
+	case <-drained:
+		return nil
+	case <-ctx.Done():
+		return fmt.Errorf("shutdown: waiting on queued notifications: %v", ctx.Err())
+	}
+}
@@ -0,0 +1,58 @@
+package main
+
+import (
+	"net/http"
+	"os"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestDrainFlushesQueue(t *testing.T) {
+	assert := assert.New(t)
+
+	var delivered []string
+	queue := newDeliveryQueue(8, queueFullPolicyBlock, func(n *notification) error {
+		time.Sleep(time.Millisecond)
+		delivered = append(delivered, n.Text)
+		return nil
+	})
+	queue.Start()
+	for _, text := range []string{"one", "two", "three"} {
+		assert.Nil(queue.Enqueue(&notification{Text: text}))
+	}
+
+	assert.Nil(drain(&http.Server{}, queue, time.Second))
+	assert.Equal([]string{"one", "two", "three"}, delivered)
+	assert.NotNil(queue.Enqueue(&notification{Text: "late"}), "the queue is closed once drained")
+}
+
+func TestDrainTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	release := make(chan struct{})
+	defer close(release)
+	queue := newDeliveryQueue(1, queueFullPolicyBlock, func(n *notification) error {
+		<-release
+		return nil
+	})
+	queue.Start()
+	assert.Nil(queue.Enqueue(&notification{Text: "stuck"}))
+
+	started := time.Now()
+	err := drain(&http.Server{}, queue, 50*time.Millisecond)
+	assert.NotNil(err)
+	assert.Contains("queued notifications", err.Error())
+	assert.True(time.Since(started) < time.Second, "drain shouldn't outlast its timeout")
+}
+
+func TestShutdownTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("SHUTDOWN_TIMEOUT", os.Getenv("SHUTDOWN_TIMEOUT"))
+	os.Setenv("SHUTDOWN_TIMEOUT", "")
+	assert.Equal(defaultShutdownTimeout, shutdownTimeout())
+	os.Setenv("SHUTDOWN_TIMEOUT", "5s")
+	assert.Equal(5*time.Second, shutdownTimeout())
+}
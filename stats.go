@@ -0,0 +1,106 @@
+package main
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wcharczuk/go-web"
+)
+
+// requestStats counts the webhooks handled since startup, for the health and metrics endpoints.
+var requestStats = newStatsCollector(time.Now)
+
+func newStatsCollector(now func() time.Time) *statsCollector {
+	return &statsCollector{now: now, started: now().UTC(), topics: map[string]int64{}}
+}
+
+// statsCollector counts requests in total and per topic, and when a request last succeeded and failed.
+type statsCollector struct {
+	sync.Mutex
+	now         func() time.Time
+	started     time.Time
+	requests    int64
+	topics      map[string]int64
+	lastSuccess time.Time
+	lastFailure time.Time
+}
+
+// statsSnapshot is the state of a statsCollector at a point in time.
+type statsSnapshot struct {
+	Started     time.Time        `json:"started"`
+	Uptime      string           `json:"uptime"`
+	Requests    int64            `json:"requests"`
+	Topics      map[string]int64 `json:"topics"`
+	LastSuccess *time.Time       `json:"last_success,omitempty"`
+	LastFailure *time.Time       `json:"last_failure,omitempty"`
+}
+
+// Record counts a request for a topic, and whether it succeeded.
+func (sc *statsCollector) Record(topic string, success bool) {
+	sc.Lock()
+	defer sc.Unlock()
+
+	sc.requests++
+	sc.topics[topic]++
+	if success {
+		sc.lastSuccess = sc.now().UTC()
+	} else {
+		sc.lastFailure = sc.now().UTC()
+	}
+}
+
+// Uptime returns the time since the collector started.
+func (sc *statsCollector) Uptime() time.Duration {
+	return sc.now().Sub(sc.started)
+}
+
+// Snapshot returns a copy of the counters.
+func (sc *statsCollector) Snapshot() *statsSnapshot {
+	sc.Lock()
+	defer sc.Unlock()
+
+	snapshot := &statsSnapshot{
+		Started:  sc.started,
+		Uptime:   sc.Uptime().String(),
+		Requests: sc.requests,
+		Topics:   make(map[string]int64, len(sc.topics)),
+	}
+	for topic, count := range sc.topics {
+		snapshot.Topics[topic] = count
+	}
+	if !sc.lastSuccess.IsZero() {
+		lastSuccess := sc.lastSuccess
+		snapshot.LastSuccess = &lastSuccess
+	}
+	if !sc.lastFailure.IsZero() {
+		lastFailure := sc.lastFailure
+		snapshot.LastFailure = &lastFailure
+	}
+	return snapshot
+}
+
+// collectStats records every request in `requestStats`, by the `X-Shopify-Topic` header or else by its
+// path, as a success unless it responds with an error status. It also counts it in `requestsReceived`.
+func collectStats(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		requestsReceived.Inc(rc.Request.URL.Path)
+		result := action(rc)
+
+		topic := strings.ToLower(strings.TrimSpace(rc.Request.Header.Get("X-Shopify-Topic")))
+		if len(topic) == 0 {
+			topic = rc.Request.URL.Path
+		}
+		requestStats.Record(topic, resultStatusCode(result) < http.StatusBadRequest)
+		return result
+	}
+}
+
+// resultStatusCode returns the status code a result will respond with.
+func resultStatusCode(result web.ControllerResult) int {
+	if typed, isJSON := result.(*web.JSONResult); isJSON {
+		return typed.StatusCode
+	}
+	return http.StatusOK
+}
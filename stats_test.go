@@ -0,0 +1,70 @@
+package main
+
+import (
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+)
+
+func TestStatsCollector(t *testing.T) {
+	assert := assert.New(t)
+
+	clock := &fakeClock{current: time.Date(2017, 3, 1, 12, 0, 0, 0, time.UTC)}
+	stats := newStatsCollector(clock.Now)
+
+	snapshot := stats.Snapshot()
+	assert.Zero(snapshot.Requests)
+	assert.Empty(snapshot.Topics)
+	assert.Nil(snapshot.LastSuccess)
+	assert.Nil(snapshot.LastFailure)
+
+	clock.Sleep(time.Minute)
+	stats.Record("orders/create", true)
+	stats.Record("orders/create", true)
+	clock.Sleep(time.Minute)
+	stats.Record("customers/create", false)
+
+	snapshot = stats.Snapshot()
+	assert.Equal(int64(3), snapshot.Requests)
+	assert.Equal(map[string]int64{"orders/create": 2, "customers/create": 1}, snapshot.Topics)
+	assert.Equal(clock.current.Add(-time.Minute), *snapshot.LastSuccess)
+	assert.Equal(clock.current, *snapshot.LastFailure)
+	assert.Equal(2*time.Minute, stats.Uptime())
+	assert.Equal("2m0s", snapshot.Uptime)
+
+	stats.Record("orders/create", true)
+	assert.Equal(int64(3), snapshot.Requests, "snapshots are copies")
+	assert.Equal(int64(2), snapshot.Topics["orders/create"])
+}
+
+func TestCollectStats(t *testing.T) {
+	assert := assert.New(t)
+
+	captured := recordOutbound(http.StatusOK, "ok")
+	defer captured.Restore()
+	defer func(stats *statsCollector) { requestStats = stats }(requestStats)
+	requestStats = newStatsCollector(time.Now)
+
+	app := newApp()
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithHeader("X-Shopify-Topic", "orders/create").
+		WithPostBody([]byte(`{"id":450789469,"total_price":"12.50"}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+
+	res, err = app.Mock().WithVerb("POST").WithPathf("/shopper").WithPostBody([]byte(`{"id":`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusBadRequest, res.StatusCode)
+
+	snapshot := requestStats.Snapshot()
+	assert.Equal(int64(2), snapshot.Requests)
+	assert.Equal(map[string]int64{"orders/create": 1, "/shopper": 1}, snapshot.Topics)
+	assert.NotNil(snapshot.LastSuccess)
+	assert.NotNil(snapshot.LastFailure)
+
+	var health healthResult
+	assert.Nil(app.Mock().WithPathf("/healthz").JSON(&health))
+	assert.Equal("ok!", health.Status)
+	assert.Equal(int64(2), health.Stats.Requests)
+}
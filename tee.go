@@ -0,0 +1,113 @@
+package main
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/wcharczuk/go-web"
+)
+
+const (
+	defaultTeeTimeout        = 2 * time.Second
+	defaultTeeRetryAttempts  = 2
+	defaultTeeRetryBaseDelay = 100 * time.Millisecond
+)
+
+var (
+	_teeRetryPolicy     *retryPolicy
+	_teeRetryPolicyOnce sync.Once
+)
+
+// teeInflight tracks forwards in progress, so shutdown can wait for them.
+var teeInflight sync.WaitGroup
+
+// teeURL returns the url raw webhooks are forwarded to, from `TEE_URL`; webhooks aren't forwarded if it's unset.
+func teeURL() string {
+	return strings.TrimSpace(os.Getenv("TEE_URL"))
+}
+
+// teeTimeout returns the timeout for each forward attempt, from `TEE_TIMEOUT`.
+func teeTimeout() time.Duration {
+	return envDuration("TEE_TIMEOUT", defaultTeeTimeout)
+}
+
+// teeRetryPolicy returns the retry policy for forwards, from `TEE_RETRY_ATTEMPTS` and `TEE_RETRY_BASE_DELAY`.
+// It's independent of `deliveryRetryPolicy()`, since the sink's pipelines have their own SLAs. It's built
+// once, since concurrent forwards can race to the first one.
+func teeRetryPolicy() *retryPolicy {
+	_teeRetryPolicyOnce.Do(func() {
+		if _teeRetryPolicy != nil {
+			return
+		}
+		_teeRetryPolicy = &retryPolicy{
+			Attempts:  envInt("TEE_RETRY_ATTEMPTS", defaultTeeRetryAttempts),
+			BaseDelay: envDuration("TEE_RETRY_BASE_DELAY", defaultTeeRetryBaseDelay),
+			MaxDelay:  defaultRetryMaxDelay,
+		}
+	})
+	return _teeRetryPolicy
+}
+
+// teeWebhook forwards the raw body and shopify headers of each webhook to `TEE_URL` in the background,
+// after the webhook is handled. Forwards are counted in `teeSuccesses` and `teeFailures`, and never
+// affect the webhook's response.
+func teeWebhook(action web.ControllerAction) web.ControllerAction {
+	return func(rc *web.RequestContext) web.ControllerResult {
+		result := action(rc)
+
+		url := teeURL()
+		if len(url) == 0 {
+			return result
+		}
+		route, body, headers := rc.Request.URL.Path, rc.PostBody(), teeHeaders(rc.Request.Header)
+		logger := rc.Logger()
+
+		teeInflight.Add(1)
+		go func() {
+			defer teeInflight.Done()
+			if err := forwardWebhook(url, body, headers, teeTimeout(), teeRetryPolicy()); err != nil {
+				teeFailures.Inc(route)
+				if logger != nil {
+					logger.Errorf("teeWebhook::forwardWebhook() %v", err)
+				}
+				return
+			}
+			teeSuccesses.Inc(route)
+		}()
+		return result
+	}
+}
+
+// teeHeaders returns the headers forwarded with a webhook: its content type and shopify's headers.
+func teeHeaders(header http.Header) http.Header {
+	forwarded := http.Header{}
+	for name, values := range header {
+		if strings.HasPrefix(strings.ToLower(name), "x-shopify-") || strings.EqualFold(name, "Content-Type") {
+			forwarded[name] = values
+		}
+	}
+	return forwarded
+}
+
+// forwardWebhook posts a raw webhook to the tee sink, with each attempt bounded by `timeout`.
+// Non-2xx responses are failures, and retried like any other.
+func forwardWebhook(url string, body []byte, headers http.Header, timeout time.Duration, policy *retryPolicy) error {
+	return policy.Do(func() error {
+		req := outboundRequest(nil).AsPost().WithURL(url).WithRawBody(body).WithTimeout(timeout)
+		for name := range headers {
+			req = req.WithHeader(name, headers.Get(name))
+		}
+		meta, err := req.ExecuteWithMeta()
+		if err != nil {
+			return err
+		}
+		if meta.StatusCode < http.StatusOK || meta.StatusCode >= http.StatusMultipleChoices {
+			return fmt.Errorf("tee sink responded %d", meta.StatusCode)
+		}
+		return nil
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/blendlabs/go-assert"
+	"github.com/blendlabs/go-request"
+	"github.com/wcharczuk/go-web"
+)
+
+func TestTeeSettings(t *testing.T) {
+	assert := assert.New(t)
+
+	defer os.Setenv("TEE_TIMEOUT", os.Getenv("TEE_TIMEOUT"))
+	defer os.Setenv("TEE_RETRY_ATTEMPTS", os.Getenv("TEE_RETRY_ATTEMPTS"))
+	defer func(policy *retryPolicy) {
+		_teeRetryPolicy, _teeRetryPolicyOnce = policy, sync.Once{}
+	}(_teeRetryPolicy)
+
+	os.Setenv("TEE_TIMEOUT", "")
+	assert.Equal(defaultTeeTimeout, teeTimeout())
+	os.Setenv("TEE_TIMEOUT", "250ms")
+	assert.Equal(250*time.Millisecond, teeTimeout())
+
+	_teeRetryPolicy, _teeRetryPolicyOnce = nil, sync.Once{}
+	os.Setenv("TEE_RETRY_ATTEMPTS", "5")
+	assert.Equal(5, teeRetryPolicy().Attempts)
+	assert.NotEqual(deliveryRetryPolicy(), teeRetryPolicy())
+}
+
+func TestTeeRetryPolicyBuiltOnce(t *testing.T) {
+	assert := assert.New(t)
+
+	defer func(policy *retryPolicy) {
+		_teeRetryPolicy, _teeRetryPolicyOnce = policy, sync.Once{}
+	}(_teeRetryPolicy)
+	_teeRetryPolicy, _teeRetryPolicyOnce = nil, sync.Once{}
+
+	policies := make(chan *retryPolicy, 8)
+	var wg sync.WaitGroup
+	for index := 0; index < cap(policies); index++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			policies <- teeRetryPolicy()
+		}()
+	}
+	wg.Wait()
+	close(policies)
+
+	first := <-policies
+	assert.NotNil(first)
+	for policy := range policies {
+		assert.True(first == policy, "every forward shares one policy")
+	}
+}
+
+func TestForwardWebhookTimeout(t *testing.T) {
+	assert := assert.New(t)
+
+	var timeouts []time.Duration
+	defer func() { outboundHook = nil }()
+	outboundHook = func(req *request.HTTPRequest) *request.HTTPRequest {
+		return req.WithMockedResponse(func(verb string, url *url.URL) (bool, *request.HTTPResponseMeta, []byte, error) {
+			timeouts = append(timeouts, req.Timeout)
+			return true, &request.HTTPResponseMeta{StatusCode: http.StatusServiceUnavailable}, nil, nil
+		})
+	}
+
+	clock := &fakeClock{current: time.Now()}
+	policy := &retryPolicy{Attempts: 2, BaseDelay: time.Second, now: clock.Now, sleep: clock.Sleep}
+	err := forwardWebhook("https://pipeline.example.com/shopify", []byte(`{}`), http.Header{}, 250*time.Millisecond, policy)
+	assert.NotNil(err)
+	assert.Contains("503", err.Error())
+	assert.Equal([]time.Duration{250 * time.Millisecond, 250 * time.Millisecond}, timeouts, "every attempt uses the tee's timeout")
+	assert.Len(clock.slept, 1)
+}
+
+func TestTeeFailureDoesntAffectNotification(t *testing.T) {
+	assert := assert.New(t)
+	defer resetMetrics()
+	resetMetrics()
+
+	defer os.Setenv("TEE_URL", os.Getenv("TEE_URL"))
+	os.Setenv("TEE_URL", "https://pipeline.example.com/shopify")
+	defer func(policy *retryPolicy) { _teeRetryPolicy = policy }(teeRetryPolicy())
+	_teeRetryPolicy = &retryPolicy{Attempts: 1}
+
+	var mutex sync.Mutex
+	var slackBodies [][]byte
+	var teed []http.Header
+	defer func() { outboundHook = nil }()
+	outboundHook = func(req *request.HTTPRequest) *request.HTTPRequest {
+		return req.WithMockedResponse(func(verb string, url *url.URL) (bool, *request.HTTPResponseMeta, []byte, error) {
+			mutex.Lock()
+			defer mutex.Unlock()
+			if url.Host == "pipeline.example.com" {
+				teed = append(teed, req.Header)
+				return true, &request.HTTPResponseMeta{StatusCode: http.StatusBadGateway}, nil, nil
+			}
+			slackBodies = append(slackBodies, req.Body)
+			return true, &request.HTTPResponseMeta{StatusCode: http.StatusOK}, []byte("ok"), nil
+		})
+	}
+
+	app := newApp()
+	app.SetLogger(web.NewLogger(ioutil.Discard, ioutil.Discard))
+	res, err := app.Mock().WithVerb("POST").WithPathf("/order").WithHeader("X-Shopify-Topic", "orders/create").
+		WithPostBody([]byte(`{"id":450789469,"total_price":"12.50"}`)).Response()
+	assert.Nil(err)
+	assert.Equal(http.StatusOK, res.StatusCode)
+	teeInflight.Wait()
+
+	assert.Len(slackBodies, 1)
+	assert.Contains("New Sale!", string(slackBodies[0]))
+	assert.Len(teed, 1)
+	assert.Equal("orders/create", teed[0].Get("X-Shopify-Topic"))
+	assert.Equal(int64(1), teeFailures.Value("/order"))
+	assert.Zero(teeSuccesses.Value("/order"))
+	assert.Equal(int64(1), slackPostSuccesses.Value("orders/create"))
+}